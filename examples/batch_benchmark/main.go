@@ -0,0 +1,77 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/GravityInfinite/go-sdk/src/gedata"
+)
+
+// Measure the throughput of Track with GEBatchConsumer under concurrent producers, against a local
+// receiver which answers every request after a fixed latency.
+//
+//	go run ./examples/batch_benchmark -producers 16 -events 10000 -latency 50ms -workers 8
+func main() {
+	producers := flag.Int("producers", 8, "number of goroutines calling Track")
+	events := flag.Int("events", 10000, "events tracked by each producer")
+	latency := flag.Duration("latency", 20*time.Millisecond, "latency of the receiver")
+	batchSize := flag.Int("batch", gedata.DefaultBatchSize, "batch size of the consumer")
+	workers := flag.Int("workers", gedata.DefaultUploadWorkers, "upload workers of the consumer")
+	flag.Parse()
+
+	var requests atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+		time.Sleep(*latency)
+		requests.Add(1)
+		_, _ = w.Write([]byte(`{"code":0,"msg":"ok"}`))
+	}))
+	defer server.Close()
+
+	total := *producers * *events
+	consumer, err := gedata.NewBatchConsumerWithConfig(gedata.GEBatchConfig{
+		ServerUrl:     server.URL,
+		BatchSize:     *batchSize,
+		Compress:      true,
+		QueueSize:     total,
+		UploadWorkers: *workers,
+	})
+	if err != nil {
+		panic(err)
+	}
+	ge := gedata.New(consumer, gedata.WithLogLevel(gedata.GELogLevelOff))
+
+	var failed atomic.Int64
+	var wg sync.WaitGroup
+	start := time.Now()
+	for p := 0; p < *producers; p++ {
+		wg.Add(1)
+		go func(p int) {
+			defer wg.Done()
+			clientId := fmt.Sprintf("client_%d", p)
+			for i := 0; i < *events; i++ {
+				if err := ge.Track(clientId, "benchmark", map[string]interface{}{"index": i}); err != nil {
+					failed.Add(1)
+				}
+			}
+		}(p)
+	}
+	wg.Wait()
+	tracked := time.Since(start)
+
+	if err := ge.Close(); err != nil {
+		fmt.Println("close failed:", err)
+	}
+	uploaded := time.Since(start)
+
+	fmt.Printf("producers: %d, events: %d, failed: %d\n", *producers, total, failed.Load())
+	fmt.Printf("track:  %v, %.0f events/s, %v per event\n",
+		tracked, float64(total)/tracked.Seconds(), tracked/time.Duration(total))
+	fmt.Printf("upload: %v, %d requests\n", uploaded, requests.Load())
+}
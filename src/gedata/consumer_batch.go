@@ -3,41 +3,64 @@ package gedata
 import (
 	"bytes"
 	"compress/gzip"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"hash/fnv"
 	"io"
 	"net/http"
 	"net/url"
 	"strconv"
-	"strings"
 	"sync"
 	"time"
 )
 
-// GEBatchConsumer upload data to GE by http
+// GEBatchConsumer upload data to GE by http. Add only puts data into a bounded queue, batches are built
+// and uploaded by a sender goroutine, so Add never waits for the network. Data lost by the sender is
+// notified in order by another goroutine, so the drop handler may call Flush of the same consumer.
 type GEBatchConsumer struct {
-	serverUrl   string // serverUrl
-	compress    bool   // is need compress
-	bufferMutex *sync.RWMutex
-	cacheMutex  *sync.RWMutex // cache mutex
+	serverUrl  string // serverUrl
+	compress   bool   // is need compress
+	HttpClient *http.Client
 
+	queue    chan Data
+	requests chan batchRequest // flush and close requests handled by the sender
+	stopped  chan struct{}     // closed when the sender exits
+	chMutex  *sync.RWMutex     // guards queue and closed, so that sending never races with close
+	closed   bool
+
+	// owned by the sender goroutine
 	buffer        []Data
+	events        int      // count of events in buffer
 	batchSize     int      // flush event count each time
 	cacheBuffer   [][]Data // buffer
 	cacheCapacity int      // buffer max count
-	HttpClient    *http.Client
+	attempted     int      // leading batches of cacheBuffer which have been uploaded before, only they may be evicted
+
+	uploadWorkers int           // goroutines uploading the clients of a batch
+	inFlight      chan struct{} // semaphore of http requests
+
+	dropMutex *sync.Mutex
+	drops     []dropRecord  // lost data waiting for the drop goroutine, guarded by dropMutex
+	dropWake  chan struct{} // signals the drop goroutine that drops is not empty
+	dropsDone chan struct{} // closed when the drop goroutine exits
+	dropNotifier
+	loggerHolder
 }
 
 type GEBatchConfig struct {
 	ServerUrl     string       // serverUrl
-	BatchSize     int          // flush event count each time
+	BatchSize     int          // max count of events in one request, larger Data is split
 	Timeout       int          // http timeout (mill second)
 	Compress      bool         // enable compress data
 	AutoFlush     bool         // enable auto flush
 	Interval      int          // auto flush spacing (second)
-	CacheCapacity int          // cache event count
+	CacheCapacity int          // max count of batches in cache, if it is full the oldest batch which failed to upload is dropped
 	HttpClient    *http.Client // Custom http client. Set this parameter when you want to use your own http client
+	QueueSize     int          // max count of data waiting for the sender, Add fails with ErrChannelFull if it is full
+	UploadWorkers int          // count of goroutines uploading the clients of a batch concurrently, a client is always uploaded by the same one
+	MaxInFlight   int          // max count of concurrent http requests, default and upper limit is UploadWorkers
 }
 
 const (
@@ -46,8 +69,18 @@ const (
 	MaxBatchSize         = 200
 	DefaultInterval      = 30
 	DefaultCacheCapacity = 50
+	DefaultQueueSize     = 10000
+	DefaultUploadWorkers = 4
 )
 
+// batchRequest is handled by the sender goroutine, after the data queued before it has been buffered.
+type batchRequest struct {
+	ctx   context.Context
+	all   bool // ignore the errors of invalid data, as FlushAll
+	close bool
+	done  chan error
+}
+
 // NewBatchConsumer create GEBatchConsumer
 func NewBatchConsumer(serverUrl string) (GEConsumer, error) {
 	config := GEBatchConfig{
@@ -86,9 +119,9 @@ func NewBatchConsumerWithConfig(config GEBatchConfig) (GEConsumer, error) {
 
 func initBatchConsumer(config GEBatchConfig) (GEConsumer, error) {
 	if config.ServerUrl == "" {
-		msg := fmt.Sprint("ServerUrl must not be empty")
-		geLogInfo(msg)
-		return nil, errors.New(msg)
+		err := fmt.Errorf("%w: ServerUrl must not be empty", ErrInvalidConfig)
+		geLogInfo(err.Error())
+		return nil, err
 	}
 	u, err := url.Parse(config.ServerUrl)
 	if err != nil {
@@ -123,17 +156,40 @@ func initBatchConsumer(config GEBatchConfig) (GEConsumer, error) {
 		httpClient = &http.Client{Timeout: timeout}
 	}
 
+	queueSize := DefaultQueueSize
+	if config.QueueSize > 0 {
+		queueSize = config.QueueSize
+	}
+
+	uploadWorkers := DefaultUploadWorkers
+	if config.UploadWorkers > 0 {
+		uploadWorkers = config.UploadWorkers
+	}
+	// each worker sends one request at a time, more requests in flight are never reached
+	maxInFlight := uploadWorkers
+	if config.MaxInFlight > 0 && config.MaxInFlight < uploadWorkers {
+		maxInFlight = config.MaxInFlight
+	}
+
 	c := &GEBatchConsumer{
 		serverUrl:     u.String(),
 		compress:      config.Compress,
-		bufferMutex:   new(sync.RWMutex),
-		cacheMutex:    new(sync.RWMutex),
+		queue:         make(chan Data, queueSize),
+		requests:      make(chan batchRequest),
+		stopped:       make(chan struct{}),
+		chMutex:       new(sync.RWMutex),
 		batchSize:     batchSize,
 		buffer:        make([]Data, 0, batchSize),
 		cacheCapacity: cacheCapacity,
 		cacheBuffer:   make([][]Data, 0, cacheCapacity),
 		HttpClient:    httpClient,
+		uploadWorkers: uploadWorkers,
+		inFlight:      make(chan struct{}, maxInFlight),
+		dropMutex:     new(sync.Mutex),
+		dropWake:      make(chan struct{}, 1),
+		dropsDone:     make(chan struct{}),
 	}
+	c.initLogger("batch", nil)
 
 	var interval int
 	if config.Interval == 0 {
@@ -141,149 +197,478 @@ func initBatchConsumer(config GEBatchConfig) (GEConsumer, error) {
 	} else {
 		interval = config.Interval
 	}
+	var tick time.Duration
 	if config.AutoFlush {
-		go func() {
-			ticker := time.NewTicker(time.Duration(interval) * time.Second)
-			defer ticker.Stop()
-			for {
-				<-ticker.C
-				_ = c.timerFlush()
-			}
-		}()
+		tick = time.Duration(interval) * time.Second
 	}
+	go c.run(tick)
+	go c.runDrops()
 
-	geLogInfo("Mode: batch consumer,  serverUrl: %s", c.serverUrl)
+	c.logger().info("Mode: batch consumer,  serverUrl: %s", c.serverUrl)
 
 	return c, nil
 }
 
 func (c *GEBatchConsumer) Add(d Data) error {
-	c.bufferMutex.Lock()
-	c.buffer = append(c.buffer, d)
-	c.bufferMutex.Unlock()
+	return c.AddCtx(context.Background(), d)
+}
 
-	if c.getBufferLength() >= c.batchSize || c.getCacheLength() > 0 {
-		err := c.Flush()
+// AddCtx put data into the queue. If the queue is full and ctx can be done, it waits for free space
+// until ctx is done, otherwise it fails immediately.
+func (c *GEBatchConsumer) AddCtx(ctx context.Context, d Data) error {
+	if err := ctx.Err(); err != nil {
 		return err
 	}
 
-	return nil
-}
+	var err error
+	c.chMutex.RLock()
+	if c.closed {
+		err = fmt.Errorf("add event failed: %w", ErrConsumerClosed)
+	} else if ctx.Done() == nil {
+		select {
+		case c.queue <- d:
+		default:
+			err = fmt.Errorf("add event failed: %w", ErrChannelFull)
+		}
+	} else {
+		select {
+		case c.queue <- d:
+		case <-ctx.Done():
+			err = fmt.Errorf("add event failed: %w: %w", ErrChannelFull, ctx.Err())
+		}
+	}
+	c.chMutex.RUnlock()
 
-func (c *GEBatchConsumer) timerFlush() error {
-	geLogInfo("timer flush data")
-	return c.innerFlush()
+	if err != nil {
+		c.logger().with(LogField{Key: LogFieldClientId, Value: d.ClientId}).error(err.Error())
+		if errors.Is(err, ErrChannelFull) {
+			c.notifyDrop(ctx, c.logger(), d, DropReasonChannelFull, err)
+		}
+	}
+	return err
 }
 
 func (c *GEBatchConsumer) Flush() error {
-	geLogInfo("flush data")
-	return c.innerFlush()
+	return c.FlushCtx(context.Background())
 }
 
-func (c *GEBatchConsumer) innerFlush() error {
-	c.cacheMutex.Lock()
-	defer c.cacheMutex.Unlock()
+// FlushCtx upload the data added before, it returns ErrConsumerClosed after Close.
+func (c *GEBatchConsumer) FlushCtx(ctx context.Context) error {
+	c.logger().info("flush data")
+	c.chMutex.RLock()
+	closed := c.closed
+	c.chMutex.RUnlock()
+	if closed {
+		return fmt.Errorf("flush failed: %w", ErrConsumerClosed)
+	}
+	return c.request(ctx, false, false)
+}
 
-	c.bufferMutex.Lock()
-	defer c.bufferMutex.Unlock()
+// request pass a request to the sender and wait for its result or ctx.
+func (c *GEBatchConsumer) request(ctx context.Context, all, close bool) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	req := batchRequest{ctx: ctx, all: all, close: close, done: make(chan error, 1)}
+	select {
+	case c.requests <- req:
+	case <-c.stopped:
+		// everything has been uploaded by Close
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case err := <-req.done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
 
-	if len(c.buffer) == 0 && len(c.cacheBuffer) == 0 {
-		geLogInfo("flush data: len(c.buffer) == 0 && len(c.cacheBuffer) == 0")
+// run is the sender goroutine, it exits once the consumer is closed and all data is uploaded.
+func (c *GEBatchConsumer) run(tick time.Duration) {
+	defer close(c.stopped)
+	var ticks <-chan time.Time
+	if tick > 0 {
+		ticker := time.NewTicker(tick)
+		defer ticker.Stop()
+		ticks = ticker.C
+	}
+	queue := c.queue
+	for {
+		select {
+		case d, ok := <-queue:
+			if !ok {
+				// closed, the close request follows
+				queue = nil
+				continue
+			}
+			c.bufferData(d)
+			if c.events >= c.batchSize {
+				// the queued data is uploaded together, so that the upload workers have more clients to share.
+				// The rest is left in the queue, so that Add fails with ErrChannelFull instead of evicting data.
+				queue, _ = c.drain(queue)
+				_ = c.flush(context.Background(), false, true)
+			}
+		case <-ticks:
+			c.logger().info("timer flush data")
+			_ = c.flush(context.Background(), true, false)
+		case req := <-c.requests:
+			// the data queued before the request is uploaded in rounds which fit in the cache
+			var err error
+			for pending := len(queue); ; {
+				var drained int
+				queue, drained = c.drain(queue)
+				pending -= drained
+				err = c.flush(req.ctx, req.all, false)
+				if err != nil || queue == nil || (pending <= 0 && !req.close) {
+					break
+				}
+			}
+			req.done <- err
+			if req.close && queue == nil && len(c.buffer) == 0 && len(c.cacheBuffer) == 0 {
+				return
+			}
+		}
+	}
+}
 
-		return nil
+// runDrops is the drop goroutine, it notifies the data lost by the sender and exits after the sender.
+func (c *GEBatchConsumer) runDrops() {
+	defer close(c.dropsDone)
+	for {
+		select {
+		case <-c.dropWake:
+			c.notifyDrops()
+		case <-c.stopped:
+			c.notifyDrops()
+			return
+		}
+	}
+}
+
+func (c *GEBatchConsumer) notifyDrops() {
+	c.dropMutex.Lock()
+	drops := c.drops
+	c.drops = nil
+	c.dropMutex.Unlock()
+	for _, record := range drops {
+		c.notifyDrop(context.Background(), c.logger(), record.data, record.reason, record.err)
+	}
+}
+
+// room return the count of events which can be buffered without evicting data which has never been sent.
+func (c *GEBatchConsumer) room() int {
+	return (c.cacheCapacity-(len(c.cacheBuffer)-c.attempted))*c.batchSize - c.events
+}
+
+// drain move queued data into the buffer while there is room, and return the count of data moved.
+// The queue returned is nil if it is closed and empty.
+func (c *GEBatchConsumer) drain(queue chan Data) (chan Data, int) {
+	drained := 0
+	for queue != nil && c.room() > 0 {
+		select {
+		case d, ok := <-queue:
+			if !ok {
+				return nil, drained
+			}
+			c.bufferData(d)
+			drained++
+		default:
+			return queue, drained
+		}
 	}
+	return queue, drained
+}
+
+// bufferData append data to the buffer. Data with more events than batchSize is split, so that no
+// request exceeds batchSize; its parts are uploaded in order, but may be sent or dropped separately.
+func (c *GEBatchConsumer) bufferData(d Data) {
+	for len(d.EventList) > c.batchSize {
+		c.buffer = append(c.buffer, Data{ClientId: d.ClientId, EventList: d.EventList[:c.batchSize:c.batchSize]})
+		c.events += c.batchSize
+		d.EventList = d.EventList[c.batchSize:]
+	}
+	c.buffer = append(c.buffer, d)
+	c.events += eventCount(d)
+}
+
+// eventCount return the count of events which data takes in a batch, at least one.
+func eventCount(d Data) int {
+	return max(len(d.EventList), 1)
+}
 
+// flush move the buffer into the cache in batches, and upload the cache. Batches which have never been
+// sent are not evicted, if they do not fit in the cache the rest of the buffer is moved after the upload.
+// The first error of invalid data is returned unless all is true. If full is true, only full batches are
+// moved, which is the case of a batch filled by Add.
+func (c *GEBatchConsumer) flush(ctx context.Context, all, full bool) error {
+	// lost data is passed to the drop goroutine at last, since the handler may wait for the sender.
+	var dropped []dropRecord
 	defer func() {
-		if len(c.cacheBuffer) > c.cacheCapacity {
-			c.cacheBuffer = c.cacheBuffer[1:]
+		if len(dropped) == 0 {
+			return
+		}
+		c.dropMutex.Lock()
+		c.drops = append(c.drops, dropped...)
+		c.dropMutex.Unlock()
+		select {
+		case c.dropWake <- struct{}{}:
+		default:
 		}
 	}()
 
-	if len(c.cacheBuffer) == 0 || len(c.buffer) >= c.batchSize {
-		c.cacheBuffer = append(c.cacheBuffer, c.buffer)
-		c.buffer = make([]Data, 0, c.batchSize)
+	for {
+		dropped = append(dropped, c.fillCache(full)...)
+		if len(c.buffer) == 0 {
+			c.buffer = make([]Data, 0, c.batchSize)
+		}
+		if len(c.cacheBuffer) == 0 {
+			c.logger().info("flush data: len(c.buffer) == 0 && len(c.cacheBuffer) == 0")
+			return nil
+		}
+
+		rejected, err := c.uploadEvents(ctx)
+		c.attempted = len(c.cacheBuffer)
+		dropped = append(dropped, rejected...)
+		// invalid data has been dropped, the rest has been sent
+		if err != nil && !(all && isDataError(err)) {
+			return err
+		}
+		if c.events < c.batchSize && (full || len(c.buffer) == 0) {
+			return nil
+		}
 	}
+}
 
-	err := c.uploadEvents()
+// fillCache move the buffer into the cache in batches of at most batchSize events. If the cache is full,
+// the oldest batch which has been uploaded before is evicted, and the evicted data is returned.
+func (c *GEBatchConsumer) fillCache(full bool) []dropRecord {
+	var evicted []dropRecord
+	for c.events >= c.batchSize || (!full && len(c.buffer) > 0) {
+		if len(c.cacheBuffer) >= c.cacheCapacity {
+			if c.attempted == 0 {
+				break
+			}
+			c.logger().error("cache is full, the oldest %d data are dropped", len(c.cacheBuffer[0]))
+			for _, d := range c.cacheBuffer[0] {
+				evicted = append(evicted, dropRecord{data: d, reason: DropReasonCacheEvicted, err: ErrCacheFull})
+			}
+			c.cacheBuffer = c.cacheBuffer[1:]
+			c.attempted--
+		}
+		// a batch takes the leading data up to batchSize events
+		n, events := 1, eventCount(c.buffer[0])
+		for ; n < len(c.buffer) && events+eventCount(c.buffer[n]) <= c.batchSize; n++ {
+			events += eventCount(c.buffer[n])
+		}
+		c.cacheBuffer = append(c.cacheBuffer, c.buffer[:n:n])
+		c.buffer = c.buffer[n:]
+		c.events -= events
+	}
+	return evicted
+}
 
-	return err
+// uploadResult is the result of uploading the events of one client.
+type uploadResult struct {
+	sent bool
+	drop *dropRecord // set if the data is invalid or rejected by receiver
+	err  error
+}
+
+// uploadKey identifies the events of one client in one batch.
+type uploadKey struct {
+	batch    int
+	clientId string
 }
 
-func (c *GEBatchConsumer) uploadEvents() error {
-	buffer := c.cacheBuffer[0]
-	clientIdMap := map[string][]EventListItem{}
-	for _, item := range buffer {
-		clientId := item.ClientId
-		if _, ok := clientIdMap[clientId]; ok {
-			clientIdMap[clientId] = append(clientIdMap[clientId], item.EventList...)
-		} else {
-			clientIdMap[clientId] = item.EventList
+// uploadEvents upload all batches of cache. The clients are sharded by the hash of clientId among the
+// upload workers, each worker sends its clients batch by batch, so the events of a client are sent in order.
+// Data rejected by receiver would never succeed, it is dropped and the first rejection is returned.
+// Other errors keep the data which is not sent in cache, so that it can be sent again and nothing is dropped.
+func (c *GEBatchConsumer) uploadEvents(ctx context.Context) ([]dropRecord, error) {
+	var keys []uploadKey // by batch, then in the order of first appearance
+	clientIdMap := map[uploadKey][]EventListItem{}
+	for b, buffer := range c.cacheBuffer {
+		for _, item := range buffer {
+			key := uploadKey{batch: b, clientId: item.ClientId}
+			if _, ok := clientIdMap[key]; !ok {
+				keys = append(keys, key)
+			}
+			clientIdMap[key] = append(clientIdMap[key], item.EventList...)
 		}
 	}
-	for clientId, events := range clientIdMap {
-		d := Data{
-			ClientId:  clientId,
-			EventList: events,
-		}
-		geLogDebug("send len(EventList): %v", len(events))
 
-		jsonBytes, err := json.Marshal(d)
-		if err != nil {
-			return err
+	shards := make([][]int, c.uploadWorkers)
+	for i, key := range keys {
+		shard := shardOf(key.clientId, c.uploadWorkers)
+		shards[shard] = append(shards[shard], i)
+	}
+	results := make([]uploadResult, len(keys))
+	var wg sync.WaitGroup
+	for _, shard := range shards {
+		if len(shard) == 0 {
+			continue
 		}
-		params := string(jsonBytes)
-		sent := false
-		for i := 0; i < 3; i++ {
-			statusCode, code, sendErr := c.send(params, 1)
-			if statusCode == 200 {
-				if code == 0 {
-					geLogInfo("send success: %v", params)
-					sent = true
-					break
+		wg.Add(1)
+		go func(shard []int) {
+			defer wg.Done()
+			for _, i := range shard {
+				c.inFlight <- struct{}{}
+				results[i] = c.uploadClient(ctx, keys[i].clientId, clientIdMap[keys[i]])
+				<-c.inFlight
+				// the rest of the shard is kept, so that the later events of the client are not sent before
+				// the failed ones, and the others would most likely fail for the same reason
+				if results[i].err != nil && results[i].drop == nil {
+					return
 				}
-				geLogError("send fail: %v", sendErr)
-				return sendErr
 			}
-			if sendErr != nil {
-				geLogError(sendErr.Error())
-				return sendErr
+		}(shard)
+	}
+	wg.Wait()
+
+	var rejectErr, sendErr error
+	var rejected []dropRecord
+	pending := make(map[uploadKey]bool)
+	for i, result := range results {
+		switch {
+		case result.sent:
+		case result.drop != nil:
+			rejected = append(rejected, *result.drop)
+			if rejectErr == nil {
+				rejectErr = result.err
 			}
-			if i == 2 {
-				msg := fmt.Sprintf("network error, but err is nil. Status code is: %v", statusCode)
-				geLogError(msg)
-				return fmt.Errorf(msg)
+		default:
+			pending[keys[i]] = true
+			if sendErr == nil && result.err != nil {
+				sendErr = result.err
 			}
 		}
-		if !sent {
-			return fmt.Errorf("failed to send events for clientId: %s", clientId)
-		}
 	}
 
-	c.cacheBuffer = c.cacheBuffer[1:]
-	return nil
+	cache := make([][]Data, 0, len(c.cacheBuffer))
+	if len(pending) > 0 {
+		for b, buffer := range c.cacheBuffer {
+			var remaining []Data
+			for _, item := range buffer {
+				if pending[uploadKey{batch: b, clientId: item.ClientId}] {
+					remaining = append(remaining, item)
+				}
+			}
+			if len(remaining) > 0 {
+				cache = append(cache, remaining)
+			}
+		}
+	}
+	c.cacheBuffer = cache
+	if len(pending) > 0 {
+		if sendErr == nil {
+			sendErr = ctx.Err()
+		}
+		return rejected, sendErr
+	}
+	return rejected, rejectErr
 }
 
-func (c *GEBatchConsumer) FlushAll() error {
-	for c.getCacheLength() > 0 || c.getBufferLength() > 0 {
-		if err := c.Flush(); err != nil {
-			if !strings.Contains(err.Error(), "GEDataError") {
-				return err
+// uploadClient send the events of one client, retrying unexpected status codes.
+func (c *GEBatchConsumer) uploadClient(ctx context.Context, clientId string, events []EventListItem) uploadResult {
+	d := Data{
+		ClientId:  clientId,
+		EventList: events,
+	}
+	log := c.logger().with(
+		LogField{Key: LogFieldClientId, Value: clientId},
+		LogField{Key: LogFieldBatchSize, Value: len(events)},
+	)
+	log.debug("send events")
+
+	jsonBytes, err := json.Marshal(d)
+	if err != nil {
+		log.error("marshal data failed: %v", err)
+		err = fmt.Errorf("%w: %w", ErrInvalidProperty, err)
+		return uploadResult{drop: &dropRecord{data: d, reason: DropReasonInvalid, err: err}, err: err}
+	}
+	params := string(jsonBytes)
+	for i := 0; i < 3; i++ {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return uploadResult{err: ctxErr}
+		}
+		statusCode, code, sendErr := c.send(ctx, params, 1)
+		if statusCode == http.StatusOK {
+			if code == 0 {
+				log.info("send success: %v", params)
+				return uploadResult{sent: true}
+			}
+			log.with(LogField{Key: LogFieldStatusCode, Value: statusCode}).error("send fail: %v", sendErr)
+			var receiverErr *ReceiverError
+			if !errors.As(sendErr, &receiverErr) {
+				return uploadResult{err: sendErr}
 			}
+			return uploadResult{drop: &dropRecord{data: d, reason: DropReasonRejected, err: sendErr}, err: sendErr}
+		}
+		if sendErr != nil {
+			log.error(sendErr.Error())
+			return uploadResult{err: sendErr}
+		}
+		if i == 2 {
+			err = &ReceiverError{StatusCode: statusCode, Code: -1, Msg: "unexpected status code"}
+			log.with(LogField{Key: LogFieldStatusCode, Value: statusCode}).error(err.Error())
+			return uploadResult{err: err}
 		}
 	}
-	return nil
+	return uploadResult{err: ctx.Err()}
+}
+
+// shardOf return the upload worker of clientId.
+func shardOf(clientId string, workers int) int {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(clientId))
+	return int(h.Sum32() % uint32(workers))
+}
+
+func (c *GEBatchConsumer) FlushAll() error {
+	return c.FlushAllCtx(context.Background())
+}
+
+// FlushAllCtx upload all data until a network error occurs or the ctx is done, invalid data is dropped
+// without an error. It is still allowed after Close, so that data left by a failed Close can be uploaded.
+func (c *GEBatchConsumer) FlushAllCtx(ctx context.Context) error {
+	return c.request(ctx, true, false)
 }
 
 func (c *GEBatchConsumer) Close() error {
-	geLogInfo("batch consumer close")
-	return c.FlushAll()
+	return c.CloseCtx(context.Background())
+}
+
+// CloseCtx reject later Add and Flush with ErrConsumerClosed, and upload all data. Once everything is
+// uploaded, the first Close also waits for the lost data to be notified. Closing again only uploads the
+// data left by a failed Close, it does not wait, so that the drop handler may call it.
+func (c *GEBatchConsumer) CloseCtx(ctx context.Context) error {
+	c.chMutex.Lock()
+	first := !c.closed
+	if first {
+		c.closed = true
+		close(c.queue)
+		c.logger().info("batch consumer close")
+	}
+	c.chMutex.Unlock()
+	if err := c.request(ctx, true, true); err != nil || !first {
+		return err
+	}
+	select {
+	case <-c.dropsDone:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
 
 func (c *GEBatchConsumer) IsStringent() bool {
 	return false
 }
 
-func (c *GEBatchConsumer) send(data string, size int) (statusCode int, code int, err error) {
+func (c *GEBatchConsumer) send(ctx context.Context, data string, size int) (statusCode int, code int, err error) {
 	var encodedData string
 	var compressType = "gzip"
 	if c.compress {
@@ -298,7 +683,7 @@ func (c *GEBatchConsumer) send(data string, size int) (statusCode int, code int,
 	postData := bytes.NewBufferString(encodedData)
 
 	var resp *http.Response
-	req, err := http.NewRequest("POST", c.serverUrl, postData)
+	req, err := http.NewRequestWithContext(ctx, "POST", c.serverUrl, postData)
 	if err != nil {
 		return 0, 0, err
 	}
@@ -318,7 +703,7 @@ func (c *GEBatchConsumer) send(data string, size int) (statusCode int, code int,
 	defer func(Body io.ReadCloser) {
 		err := Body.Close()
 		if err != nil {
-			geLogError("close response body error: %v", err)
+			c.logger().error("close response body error: %v", err)
 		}
 	}(resp.Body)
 
@@ -327,7 +712,7 @@ func (c *GEBatchConsumer) send(data string, size int) (statusCode int, code int,
 		if readErr != nil {
 			return resp.StatusCode, 1, readErr
 		}
-		geLogDebug(string(body))
+		c.logger().debug(string(body))
 
 		var result struct {
 			Code int
@@ -341,7 +726,7 @@ func (c *GEBatchConsumer) send(data string, size int) (statusCode int, code int,
 		if result.Code == 0 {
 			return resp.StatusCode, result.Code, nil
 		}
-		return resp.StatusCode, result.Code, errors.New(result.Msg)
+		return resp.StatusCode, result.Code, &ReceiverError{StatusCode: resp.StatusCode, Code: result.Code, Msg: result.Msg}
 	} else {
 		return resp.StatusCode, -1, nil
 	}
@@ -361,15 +746,3 @@ func encodeData(data string) (string, error) {
 
 	return string(buf.Bytes()), nil
 }
-
-func (c *GEBatchConsumer) getBufferLength() int {
-	c.bufferMutex.RLock()
-	defer c.bufferMutex.RUnlock()
-	return len(c.buffer)
-}
-
-func (c *GEBatchConsumer) getCacheLength() int {
-	c.cacheMutex.RLock()
-	defer c.cacheMutex.RUnlock()
-	return len(c.cacheBuffer)
-}
@@ -0,0 +1,403 @@
+package gedata
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDropHandlerMayFlush(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+		_, _ = w.Write([]byte(`{"code":1,"msg":"rejected"}`))
+	}))
+	defer server.Close()
+	c := newTestBatchConsumer(t, GEBatchConfig{ServerUrl: server.URL})
+	ge := New(c, WithLogLevel(GELogLevelOff))
+
+	var dropped atomic.Int32
+	ge.OnDrop(func(d Data, reason DropReason, err error) {
+		if reason == DropReasonRejected {
+			_ = ge.Flush()
+			dropped.Add(1)
+		}
+	})
+
+	done := make(chan error, 1)
+	go func() {
+		if err := ge.Track("client", "event", nil); err != nil {
+			done <- err
+			return
+		}
+		var receiverErr *ReceiverError
+		if err := ge.Flush(); !errors.As(err, &receiverErr) {
+			done <- err
+			return
+		}
+		done <- ge.Close()
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("Flush called by the drop handler blocks the consumer")
+	}
+	if dropped.Load() != 1 {
+		t.Fatalf("dropped %d, want 1 before Close returns", dropped.Load())
+	}
+}
+
+func TestDropHandlerMayClose(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+		_, _ = w.Write([]byte(`{"code":1,"msg":"rejected"}`))
+	}))
+	defer server.Close()
+	c := newTestBatchConsumer(t, GEBatchConfig{ServerUrl: server.URL})
+	c.(GEDropNotifier).SetDropHandler(func(d Data, reason DropReason, err error) {
+		_ = c.Close()
+	})
+
+	done := make(chan error, 1)
+	go func() {
+		_ = c.Add(Data{ClientId: "client", EventList: []EventListItem{{Type: Track, EventName: "event"}}})
+		done <- c.Close()
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("Close called by the drop handler blocks the consumer")
+	}
+}
+
+// Measure Add of concurrent producers. Data beyond the queue fails with ErrChannelFull, which is as
+// expensive as a successful Add.
+func BenchmarkBatchConsumerAdd(b *testing.B) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+		_, _ = w.Write([]byte(`{"code":0,"msg":"ok"}`))
+	}))
+	defer server.Close()
+	c, err := NewBatchConsumerWithConfig(GEBatchConfig{ServerUrl: server.URL, Compress: true})
+	if err != nil {
+		b.Fatal(err)
+	}
+	setLogger(c, &instanceLogger{level: GELogLevelOff})
+	d := Data{
+		ClientId: "client",
+		EventList: []EventListItem{{
+			Type:       Track,
+			EventName:  "benchmark",
+			Properties: map[string]interface{}{"index": 1},
+		}},
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if err := c.Add(d); err != nil && !errors.Is(err, ErrChannelFull) {
+				b.Error(err)
+				return
+			}
+		}
+	})
+	b.StopTimer()
+	_ = c.Close()
+}
+
+func TestMaxInFlightIsLimitedByUploadWorkers(t *testing.T) {
+	for _, tc := range []struct{ workers, maxInFlight, expected int }{
+		{0, 0, DefaultUploadWorkers},
+		{8, 0, 8},
+		{8, 2, 2},
+		{2, 8, 2},
+	} {
+		c := newTestBatchConsumer(t, GEBatchConfig{UploadWorkers: tc.workers, MaxInFlight: tc.maxInFlight})
+		if n := cap(c.(*GEBatchConsumer).inFlight); n != tc.expected {
+			t.Errorf("UploadWorkers %d, MaxInFlight %d: got %d, want %d", tc.workers, tc.maxInFlight, n, tc.expected)
+		}
+		_ = c.Close()
+	}
+}
+
+func TestDropHandlerPanicIsLoggedByConsumer(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+		_, _ = w.Write([]byte(`{"code":1,"msg":"rejected"}`))
+	}))
+	defer server.Close()
+	c := newTestBatchConsumer(t, GEBatchConfig{ServerUrl: server.URL})
+	logger := &bufferLogger{}
+	setLogger(c, &instanceLogger{level: GELogLevelError, logger: logger})
+	c.(GEDropNotifier).SetDropHandler(func(d Data, reason DropReason, err error) {
+		panic("handler failed")
+	})
+
+	if err := c.Add(Data{ClientId: "client", EventList: []EventListItem{{Type: Track, EventName: "event"}}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if log := logger.String(); !strings.Contains(log, "drop handler panic: handler failed") || !strings.Contains(log, "consumer=batch") {
+		t.Fatalf("panic is not logged by the logger of the consumer: %q", log)
+	}
+}
+
+// countingServer return a receiver which counts the events it accepts, after the latency.
+func countingServer(t *testing.T, latency time.Duration, events *atomic.Int64) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var d Data
+		if err := json.NewDecoder(r.Body).Decode(&d); err != nil {
+			t.Error(err)
+		}
+		time.Sleep(latency)
+		events.Add(int64(len(d.EventList)))
+		_, _ = w.Write([]byte(`{"code":0,"msg":"ok"}`))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// A burst larger than the cache is uploaded without eviction by a healthy receiver.
+func TestBurstIsNotEvicted(t *testing.T) {
+	var received atomic.Int64
+	server := countingServer(t, 5*time.Millisecond, &received)
+	c := newTestBatchConsumer(t, GEBatchConfig{ServerUrl: server.URL})
+	ge := New(c, WithLogLevel(GELogLevelOff))
+	var dropped atomic.Int64
+	ge.OnDrop(func(d Data, reason DropReason, err error) {
+		dropped.Add(1)
+	})
+
+	const producers, events = 8, 1000
+	var wg sync.WaitGroup
+	for p := 0; p < producers; p++ {
+		wg.Add(1)
+		go func(p int) {
+			defer wg.Done()
+			clientId := fmt.Sprintf("client_%d", p)
+			for i := 0; i < events; i++ {
+				if err := ge.Track(clientId, "event", map[string]interface{}{"index": i}); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(p)
+	}
+	wg.Wait()
+	if err := ge.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if dropped.Load() != 0 || received.Load() != producers*events {
+		t.Fatalf("dropped %d, received %d of %d", dropped.Load(), received.Load(), producers*events)
+	}
+}
+
+// Flush uploads the data queued beyond the cache in rounds, nothing is evicted.
+func TestFlushDoesNotEvictQueuedData(t *testing.T) {
+	var received atomic.Int64
+	gate := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var d Data
+		if err := json.NewDecoder(r.Body).Decode(&d); err != nil {
+			t.Error(err)
+		}
+		<-gate
+		received.Add(int64(len(d.EventList)))
+		_, _ = w.Write([]byte(`{"code":0,"msg":"ok"}`))
+	}))
+	defer server.Close()
+	c := newTestBatchConsumer(t, GEBatchConfig{ServerUrl: server.URL, BatchSize: 5, CacheCapacity: 2})
+	var dropped atomic.Int64
+	c.(GEDropNotifier).SetDropHandler(func(d Data, reason DropReason, err error) {
+		dropped.Add(1)
+	})
+
+	const total = 200
+	for i := 0; i < total; i++ {
+		d := Data{ClientId: fmt.Sprintf("client_%d", i%3), EventList: []EventListItem{{Type: Track, EventName: "event"}}}
+		if err := c.Add(d); err != nil {
+			t.Fatal(err)
+		}
+	}
+	close(gate)
+	if err := c.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if dropped.Load() != 0 || received.Load() != total {
+		t.Fatalf("dropped %d, received %d of %d", dropped.Load(), received.Load(), total)
+	}
+}
+
+// Data with more events than BatchSize is split, no request exceeds BatchSize and the events of the
+// client keep their order.
+func TestLargeDataIsSplitByBatchSize(t *testing.T) {
+	var mutex sync.Mutex
+	var requests []int
+	var indexes []float64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var d Data
+		if err := json.NewDecoder(r.Body).Decode(&d); err != nil {
+			t.Error(err)
+		}
+		mutex.Lock()
+		requests = append(requests, len(d.EventList))
+		for _, item := range d.EventList {
+			indexes = append(indexes, item.Properties["index"].(float64))
+		}
+		mutex.Unlock()
+		_, _ = w.Write([]byte(`{"code":0,"msg":"ok"}`))
+	}))
+	defer server.Close()
+	c := newTestBatchConsumer(t, GEBatchConfig{ServerUrl: server.URL, BatchSize: 10, CacheCapacity: 1})
+	ge := New(c, WithLogLevel(GELogLevelOff))
+
+	const total = 36
+	items := make([]TrackItem, 0, total-1)
+	for i := 0; i < total-1; i++ {
+		items = append(items, TrackItem{EventName: "event", Properties: map[string]interface{}{"index": i}})
+	}
+	if err := ge.TrackMany("client", items); err != nil {
+		t.Fatal(err)
+	}
+	if err := ge.Track("client", "event", map[string]interface{}{"index": total - 1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ge.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, n := range requests {
+		if n > 10 {
+			t.Fatalf("requests exceed BatchSize: %v", requests)
+		}
+	}
+	if len(indexes) != total {
+		t.Fatalf("received %d of %d events", len(indexes), total)
+	}
+	for i, index := range indexes {
+		if int(index) != i {
+			t.Fatalf("events are out of order: %v", indexes)
+		}
+	}
+}
+
+// The clients of a batch are uploaded concurrently by the upload workers.
+func TestClientsAreUploadedConcurrently(t *testing.T) {
+	var current, peak atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+		n := current.Add(1)
+		for p := peak.Load(); n > p && !peak.CompareAndSwap(p, n); p = peak.Load() {
+		}
+		// wait for another request, so that the requests overlap if they are concurrent
+		for deadline := time.Now().Add(2 * time.Second); peak.Load() < 2 && time.Now().Before(deadline); {
+			time.Sleep(time.Millisecond)
+		}
+		current.Add(-1)
+		_, _ = w.Write([]byte(`{"code":0,"msg":"ok"}`))
+	}))
+	defer server.Close()
+	const workers = 4
+	c := newTestBatchConsumer(t, GEBatchConfig{ServerUrl: server.URL, BatchSize: 10, UploadWorkers: workers})
+
+	// clients of different upload workers
+	var clients []string
+	shards := map[int]bool{}
+	for i := 0; len(clients) < workers; i++ {
+		clientId := fmt.Sprintf("client_%d", i)
+		if shard := shardOf(clientId, workers); !shards[shard] {
+			shards[shard] = true
+			clients = append(clients, clientId)
+		}
+	}
+	for _, clientId := range clients {
+		if err := c.Add(Data{ClientId: clientId, EventList: []EventListItem{{Type: Track, EventName: "event"}}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if peak.Load() < 2 {
+		t.Fatalf("clients are uploaded one by one")
+	}
+}
+
+// The events of a client are sent in order across batches, when an earlier request fails and is
+// sent again. Clients of other upload workers are not held back by the failure.
+func TestClientOrderAfterFailure(t *testing.T) {
+	if shardOf("failed", DefaultUploadWorkers) == shardOf("other", DefaultUploadWorkers) {
+		t.Fatal("the clients must be uploaded by different workers")
+	}
+	var failing atomic.Bool
+	failing.Store(true)
+	var mutex sync.Mutex
+	received := map[string][]float64{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var d Data
+		if err := json.NewDecoder(r.Body).Decode(&d); err != nil {
+			t.Error(err)
+		}
+		if d.ClientId == "failed" && failing.Load() {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		mutex.Lock()
+		for _, item := range d.EventList {
+			received[d.ClientId] = append(received[d.ClientId], item.Properties["index"].(float64))
+		}
+		mutex.Unlock()
+		_, _ = w.Write([]byte(`{"code":0,"msg":"ok"}`))
+	}))
+	defer server.Close()
+	c := newTestBatchConsumer(t, GEBatchConfig{ServerUrl: server.URL, BatchSize: 2})
+	add := func(clientId string, from, to int) {
+		for i := from; i < to; i++ {
+			d := Data{ClientId: clientId, EventList: []EventListItem{{Type: Track, EventName: "event", Properties: map[string]interface{}{"index": i}}}}
+			if err := c.Add(d); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	add("failed", 0, 3)
+	add("other", 0, 3)
+	var receiverErr *ReceiverError
+	if err := c.Flush(); !errors.As(err, &receiverErr) {
+		t.Fatalf("Flush while the receiver fails: %v", err)
+	}
+	mutex.Lock()
+	if len(received["failed"]) != 0 || len(received["other"]) != 3 {
+		t.Fatalf("received while failing: %v", received)
+	}
+	mutex.Unlock()
+
+	failing.Store(false)
+	add("failed", 3, 6)
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(received["failed"]); got != "[0 1 2 3 4 5]" {
+		t.Fatalf("events of the failed client are received as %s", got)
+	}
+}
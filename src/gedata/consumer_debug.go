@@ -1,12 +1,14 @@
 package gedata
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -15,6 +17,9 @@ type GEDebugConsumer struct {
 	serverUrl  string // serverUrl
 	writeData  bool   // is archive to GE
 	httpClient *http.Client
+	mutex      *sync.RWMutex // held by Add while sending, so that Close waits for it
+	closed     bool
+	loggerHolder
 }
 
 // NewDebugConsumer init GEDebugConsumer
@@ -23,27 +28,42 @@ func NewDebugConsumer(serverUrl string) (GEConsumer, error) {
 }
 
 func NewDebugConsumerWithWriter(serverUrl string, writeData bool) (GEConsumer, error) {
-	// enable console log
-	SetLogLevel(GELogLevelDebug)
+	// enable console log of this consumer, and of the GEAnalytics using it unless it has its own log options
+	debugLogger := &instanceLogger{level: GELogLevelDebug}
 
 	if len(serverUrl) <= 0 {
-		msg := fmt.Sprint("ServerUrl must not be empty")
-		geLogError(msg)
-		return nil, errors.New(msg)
+		err := fmt.Errorf("%w: ServerUrl must not be empty", ErrInvalidConfig)
+		debugLogger.error(err.Error())
+		return nil, err
 	}
 
 	c := &GEDebugConsumer{
 		serverUrl:  serverUrl,
 		writeData:  writeData,
 		httpClient: &http.Client{Timeout: 30 * time.Second},
+		mutex:      new(sync.RWMutex),
 	}
 
-	geLogInfo("Mode: debug consumer,serverUrl: %s", c.serverUrl)
+	c.initLogger("debug", debugLogger)
+	c.logger().info("Mode: debug consumer,serverUrl: %s", c.serverUrl)
 
 	return c, nil
 }
 
 func (c *GEDebugConsumer) Add(d Data) error {
+	return c.AddCtx(context.Background(), d)
+}
+
+func (c *GEDebugConsumer) AddCtx(ctx context.Context, d Data) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	if c.closed {
+		return fmt.Errorf("add event failed: %w", ErrConsumerClosed)
+	}
 
 	jsonBytes, err := json.Marshal(d)
 	if err != nil {
@@ -52,19 +72,45 @@ func (c *GEDebugConsumer) Add(d Data) error {
 
 	jsonStr := string(jsonBytes)
 
-	geLogInfo("%v", jsonStr)
-	geLogDebug("send len(EventList): %v", len(d.EventList))
+	log := c.logger().with(
+		LogField{Key: LogFieldClientId, Value: d.ClientId},
+		LogField{Key: LogFieldBatchSize, Value: len(d.EventList)},
+	)
+	log.info("%v", jsonStr)
 
-	return c.send(jsonStr)
+	return c.send(ctx, log, jsonStr)
 }
 
 func (c *GEDebugConsumer) Flush() error {
-	geLogInfo("flush data")
+	return c.FlushCtx(context.Background())
+}
+
+// FlushCtx does nothing since data is sent by Add, it returns ErrConsumerClosed after Close.
+func (c *GEDebugConsumer) FlushCtx(ctx context.Context) error {
+	c.logger().info("flush data")
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	if c.closed {
+		return fmt.Errorf("flush failed: %w", ErrConsumerClosed)
+	}
 	return nil
 }
 
 func (c *GEDebugConsumer) Close() error {
-	geLogInfo("debug consumer close")
+	return c.CloseCtx(context.Background())
+}
+
+// CloseCtx wait for the data being sent and reject later Add, closing again does nothing.
+func (c *GEDebugConsumer) CloseCtx(ctx context.Context) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if !c.closed {
+		c.closed = true
+		c.logger().info("debug consumer close")
+	}
 	return nil
 }
 
@@ -72,9 +118,9 @@ func (c *GEDebugConsumer) IsStringent() bool {
 	return true
 }
 
-func (c *GEDebugConsumer) send(data string) error {
+func (c *GEDebugConsumer) send(ctx context.Context, log *instanceLogger, data string) error {
 	postData := strings.NewReader(data)
-	req, err := http.NewRequest("POST", c.serverUrl, postData)
+	req, err := http.NewRequestWithContext(ctx, "POST", c.serverUrl, postData)
 	if err != nil {
 		return err
 	}
@@ -93,7 +139,7 @@ func (c *GEDebugConsumer) send(data string) error {
 		}
 		result := map[string]interface{}{}
 		err = json.Unmarshal(body, &result)
-		geLogDebug("send result: %v", result)
+		log.debug("send result: %v", result)
 		if err != nil {
 			return err
 		}
@@ -106,13 +152,14 @@ func (c *GEDebugConsumer) send(data string) error {
 			return fmt.Errorf("send to receiver failed: unexpected type for 'code' field: %T", codeVal)
 		}
 		if uint64(codeFloat) != 0 {
-			msg := fmt.Sprintf("send to receiver failed with return content: %s", string(body))
-			geLogError(msg)
-			return errors.New(msg)
+			msg, _ := result["msg"].(string)
+			err = &ReceiverError{StatusCode: resp.StatusCode, Code: int(codeFloat), Msg: msg}
+			log.with(LogField{Key: LogFieldStatusCode, Value: resp.StatusCode}).error("%v, return content: %s", err, string(body))
+			return err
 		}
-		geLogInfo("send success: %v", result)
+		log.info("send success: %v", result)
 	} else {
-		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+		return &ReceiverError{StatusCode: resp.StatusCode, Code: -1, Msg: "unexpected status code"}
 	}
 	return nil
 }
@@ -1,6 +1,7 @@
 package gedata
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -28,7 +29,10 @@ type GELogConsumer struct {
 	wg             sync.WaitGroup
 	ch             chan []byte
 	mutex          *sync.RWMutex
+	chMutex        *sync.RWMutex // guards ch and sdkClose, so that sending never races with close
 	sdkClose       bool
+	dropNotifier
+	loggerHolder
 }
 
 type GELogConsumerConfig struct {
@@ -64,9 +68,9 @@ func NewLogConsumerWithConfig(config GELogConsumerConfig) (GEConsumer, error) {
 	case ROTATE_HOURLY:
 		df = "2006-01-02-15"
 	default:
-		errStr := "unknown Rotate mode"
-		geLogInfo(errStr)
-		return nil, errors.New(errStr)
+		err := fmt.Errorf("%w: unknown Rotate mode", ErrInvalidConfig)
+		geLogInfo(err.Error())
+		return nil, err
 	}
 
 	chanSize := DefaultChannelSize
@@ -82,42 +86,75 @@ func NewLogConsumerWithConfig(config GELogConsumerConfig) (GEConsumer, error) {
 		wg:             sync.WaitGroup{},
 		ch:             make(chan []byte, chanSize),
 		mutex:          new(sync.RWMutex),
+		chMutex:        new(sync.RWMutex),
 		sdkClose:       false,
 	}
+	c.initLogger("log", nil)
 
 	return c, c.init()
 }
 
 func (c *GELogConsumer) Add(d Data) error {
-	var err error = nil
-	c.mutex.Lock()
-	if c.sdkClose {
-		err = errors.New("add event failed, SDK has been closed")
+	return c.AddCtx(context.Background(), d)
+}
+
+// AddCtx write data to the channel. If the channel is full and ctx can be done, it waits
+// for free space until ctx is done, otherwise it fails immediately.
+func (c *GELogConsumer) AddCtx(ctx context.Context, d Data) error {
+	if err := ctx.Err(); err != nil {
+		return err
 	}
-	c.mutex.Unlock()
+
+	log := c.logger().with(LogField{Key: LogFieldClientId, Value: d.ClientId})
+	jsonBytes, err := json.Marshal(d)
 	if err != nil {
-		geLogError(err.Error())
+		log.error(err.Error())
 		return err
 	}
 
-	jsonBytes, jsonErr := json.Marshal(d)
-	if jsonErr != nil {
-		err = jsonErr
-	} else {
+	c.chMutex.RLock()
+	if c.sdkClose {
+		err = fmt.Errorf("add event failed: %w", ErrConsumerClosed)
+	} else if ctx.Done() == nil {
 		select {
 		case c.ch <- jsonBytes:
 		default:
-			err = errors.New("add event failed, channel is full")
+			err = fmt.Errorf("add event failed: %w", ErrChannelFull)
+		}
+	} else {
+		select {
+		case c.ch <- jsonBytes:
+		case <-ctx.Done():
+			err = fmt.Errorf("add event failed: %w: %w", ErrChannelFull, ctx.Err())
 		}
 	}
+	c.chMutex.RUnlock()
+
 	if err != nil {
-		geLogError(err.Error())
+		log.error(err.Error())
+		if errors.Is(err, ErrChannelFull) {
+			c.notifyDrop(ctx, c.logger(), d, DropReasonChannelFull, err)
+		}
 	}
 	return err
 }
 
 func (c *GELogConsumer) Flush() error {
-	geLogInfo("flush data")
+	return c.FlushCtx(context.Background())
+}
+
+// FlushCtx sync the current file, it returns ErrConsumerClosed after Close.
+func (c *GELogConsumer) FlushCtx(ctx context.Context) error {
+	c.logger().info("flush data")
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	c.chMutex.RLock()
+	closed := c.sdkClose
+	c.chMutex.RUnlock()
+	if closed {
+		return fmt.Errorf("flush failed: %w", ErrConsumerClosed)
+	}
 	var err error = nil
 	c.mutex.Lock()
 	if c.currentFile != nil {
@@ -128,21 +165,31 @@ func (c *GELogConsumer) Flush() error {
 }
 
 func (c *GELogConsumer) Close() error {
-	geLogInfo("log consumer close")
+	return c.CloseCtx(context.Background())
+}
 
-	var err error = nil
-	c.mutex.Lock()
-	if c.sdkClose {
-		err = errors.New("[gedata][error]: SDK has been closed")
-	} else {
+// CloseCtx close the channel and wait until all data has been written to file or ctx is done.
+// Closing again only waits for the data again.
+func (c *GELogConsumer) CloseCtx(ctx context.Context) error {
+	c.chMutex.Lock()
+	if !c.sdkClose {
+		c.logger().info("log consumer close")
 		c.sdkClose = true
 		close(c.ch)
 	}
-	c.mutex.Unlock()
-	if err == nil {
+	c.chMutex.Unlock()
+
+	done := make(chan struct{})
+	go func() {
 		c.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
 	}
-	return err
 }
 
 func (c *GELogConsumer) IsStringent() bool {
@@ -165,7 +212,7 @@ func (c *GELogConsumer) constructFileName(timeStr string, i int) string {
 func (c *GELogConsumer) init() error {
 	fd, err := c.initLogFile()
 	if err != nil {
-		geLogError("init log file failed: %s", err)
+		c.logger().error("init log file failed: %s", err)
 		return err
 	}
 	c.currentFile = fd
@@ -177,11 +224,11 @@ func (c *GELogConsumer) init() error {
 			if c.currentFile != nil {
 				_ = c.currentFile.Sync()
 				if closeErr := c.currentFile.Close(); closeErr != nil {
-					geLogError("close log file error: %s", closeErr)
+					c.logger().error("close log file error: %s", closeErr)
 				}
 				c.currentFile = nil
 			}
-			geLogInfo("Gracefully shutting down")
+			c.logger().info("Gracefully shutting down")
 		}()
 		for {
 			select {
@@ -190,13 +237,13 @@ func (c *GELogConsumer) init() error {
 					return
 				}
 				jsonStr := string(rec)
-				geLogDebug("write event data: %s", jsonStr)
+				c.logger().debug("write event data: %s", jsonStr)
 				c.writeToFile(jsonStr)
 			}
 		}
 	}()
 
-	geLogInfo("Mode: log consumer, log path: " + c.directory)
+	c.logger().info("Mode: log consumer, log path: " + c.directory)
 
 	return nil
 }
@@ -225,7 +272,7 @@ func (c *GELogConsumer) writeToFile(str string) {
 		c.currentFile, openFileErr = os.OpenFile(fName, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0664)
 		c.mutex.Unlock()
 		if openFileErr != nil {
-			geLogError("open log file failed: %s\n", openFileErr)
+			c.logger().error("open log file failed: %s\n", openFileErr)
 			return
 		}
 	}
@@ -243,20 +290,20 @@ func (c *GELogConsumer) writeToFile(str string) {
 		_ = c.currentFile.Sync()
 		err := c.currentFile.Close()
 		if err != nil {
-			geLogError("close file failed: %s\n", err)
+			c.logger().error("close file failed: %s\n", err)
 			return
 		}
 		c.mutex.Lock()
 		c.currentFile, err = os.OpenFile(newName, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0664)
 		c.mutex.Unlock()
 		if err != nil {
-			geLogError("Rotate log file failed: %s\n", err)
+			c.logger().error("Rotate log file failed: %s\n", err)
 			return
 		}
 	}
 	_, err := fmt.Fprintln(c.currentFile, str)
 	if err != nil {
-		geLogError("LoggerWriter(%q): %s\n", c.currentFile.Name(), err)
+		c.logger().error("LoggerWriter(%q): %s\n", c.currentFile.Name(), err)
 		return
 	}
 }
@@ -0,0 +1,214 @@
+package gedata
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"reflect"
+)
+
+// GERoute selects the items of Data which are sent to Consumer. Empty conditions match everything.
+type GERoute struct {
+	Consumer   GEConsumer
+	Types      []string                   // Track or Profile
+	EventNames []string                   // event names or patterns of path.Match, e.g. "$Ad*"
+	ClientId   func(clientId string) bool // predicate of client id
+}
+
+type GERouterConfig struct {
+	Routes  []GERoute  // the first matched route is used
+	Default GEConsumer // receives the items which match no route, they are rejected with ErrNoRoute if nil
+}
+
+// GERouterConsumer dispatch the items of Data to different consumers, a Data is split if its items
+// are routed differently, the order of items is kept within each consumer.
+type GERouterConsumer struct {
+	routes    []GERoute
+	targets   []GEContextConsumer // consumer of each route, the last one is the default consumer if any
+	consumers []GEContextConsumer // distinct consumers, used by Flush and Close
+	loggerHolder
+}
+
+// NewRouterConsumer create GERouterConsumer
+func NewRouterConsumer(config GERouterConfig) (GEConsumer, error) {
+	c := &GERouterConsumer{
+		routes: config.Routes,
+	}
+	c.initLogger("router", nil)
+	for i, route := range config.Routes {
+		if route.Consumer == nil {
+			err := fmt.Errorf("%w: consumer of route %d is nil", ErrInvalidConfig, i)
+			geLogError(err.Error())
+			return nil, err
+		}
+		for _, pattern := range route.EventNames {
+			if _, err := path.Match(pattern, ""); err != nil {
+				err = fmt.Errorf("%w: event name pattern %q of route %d: %w", ErrInvalidConfig, pattern, i, err)
+				geLogError(err.Error())
+				return nil, err
+			}
+		}
+		c.targets = append(c.targets, c.distinct(route.Consumer))
+	}
+	if config.Default != nil {
+		c.targets = append(c.targets, c.distinct(config.Default))
+	}
+	if len(c.targets) == 0 {
+		err := fmt.Errorf("%w: router consumer needs at least one route", ErrInvalidConfig)
+		geLogError(err.Error())
+		return nil, err
+	}
+
+	c.logger().info("Mode: router consumer, routes: %d", len(c.routes))
+
+	return c, nil
+}
+
+// distinct return the wrapped consumer, consumers used by several routes are wrapped only once.
+func (c *GERouterConsumer) distinct(consumer GEConsumer) GEContextConsumer {
+	if reflect.TypeOf(consumer).Comparable() {
+		for _, existing := range c.consumers {
+			if raw, ok := existing.(contextConsumerAdapter); ok && raw.GEConsumer == consumer {
+				return existing
+			}
+			if existing == consumer {
+				return existing
+			}
+		}
+	}
+	wrapped := toContextConsumer(consumer)
+	c.consumers = append(c.consumers, wrapped)
+	return wrapped
+}
+
+func (c *GERouterConsumer) Add(d Data) error {
+	return c.AddCtx(context.Background(), d)
+}
+
+func (c *GERouterConsumer) AddCtx(ctx context.Context, d Data) error {
+	var order []int // targets in the order of their first item
+	groups := make(map[int][]EventListItem)
+	unrouted := 0
+	for _, item := range d.EventList {
+		index := c.route(d.ClientId, item)
+		if index < 0 {
+			unrouted++
+			continue
+		}
+		if _, ok := groups[index]; !ok {
+			order = append(order, index)
+		}
+		groups[index] = append(groups[index], item)
+	}
+
+	log := c.logger().with(LogField{Key: LogFieldClientId, Value: d.ClientId})
+	var errs []error
+	if unrouted > 0 {
+		err := fmt.Errorf("%w: %d items of %s", ErrNoRoute, unrouted, d.ClientId)
+		log.error(err.Error())
+		errs = append(errs, err)
+	}
+	for _, index := range order {
+		err := c.targets[index].AddCtx(ctx, Data{ClientId: d.ClientId, EventList: groups[index]})
+		if err != nil {
+			log.error("router consumer: route %d failed: %v", index, err)
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// route return the index of target for item, -1 if no route matches and there is no default consumer.
+func (c *GERouterConsumer) route(clientId string, item EventListItem) int {
+	for i, route := range c.routes {
+		if route.match(clientId, item) {
+			return i
+		}
+	}
+	if len(c.targets) > len(c.routes) {
+		return len(c.routes)
+	}
+	return -1
+}
+
+func (r GERoute) match(clientId string, item EventListItem) bool {
+	if len(r.Types) > 0 && !containsString(r.Types, item.Type) {
+		return false
+	}
+	if len(r.EventNames) > 0 {
+		matched := false
+		for _, pattern := range r.EventNames {
+			if ok, _ := path.Match(pattern, item.EventName); ok {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	return r.ClientId == nil || r.ClientId(clientId)
+}
+
+func (c *GERouterConsumer) Flush() error {
+	return c.FlushCtx(context.Background())
+}
+
+func (c *GERouterConsumer) FlushCtx(ctx context.Context) error {
+	var errs []error
+	for _, consumer := range c.consumers {
+		if err := consumer.FlushCtx(ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (c *GERouterConsumer) Close() error {
+	return c.CloseCtx(context.Background())
+}
+
+func (c *GERouterConsumer) CloseCtx(ctx context.Context) error {
+	c.logger().info("router consumer close")
+	var errs []error
+	for _, consumer := range c.consumers {
+		if err := consumer.CloseCtx(ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// SetDropHandler install handler to every consumer which supports GEDropNotifier.
+func (c *GERouterConsumer) SetDropHandler(handler DropHandler) {
+	for _, consumer := range c.consumers {
+		setDropHandler(consumer, handler)
+	}
+}
+
+func (c *GERouterConsumer) setLogger(l *instanceLogger) {
+	c.loggerHolder.setLogger(l)
+	for _, consumer := range c.consumers {
+		setLogger(consumer, l)
+	}
+}
+
+// IsStringent is true if any of the consumers is stringent.
+func (c *GERouterConsumer) IsStringent() bool {
+	for _, consumer := range c.consumers {
+		if consumer.IsStringent() {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,130 @@
+package gedata
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// eventNames return the event names of every Data added to c.
+func eventNames(c *recordConsumer) []string {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	var result []string
+	for _, d := range c.data {
+		var names []string
+		for _, item := range d.EventList {
+			names = append(names, item.EventName)
+		}
+		result = append(result, strings.Join(names, ","))
+	}
+	return result
+}
+
+func TestRouterSplitsData(t *testing.T) {
+	ads, profiles, vip, other := &recordConsumer{}, &recordConsumer{}, &recordConsumer{}, &recordConsumer{}
+	c, err := NewRouterConsumer(GERouterConfig{
+		Routes: []GERoute{
+			{Consumer: vip, ClientId: func(clientId string) bool { return strings.HasPrefix(clientId, "vip_") }, Types: []string{Track}},
+			{Consumer: ads, EventNames: []string{"$Ad*", "install"}},
+			{Consumer: profiles, Types: []string{Profile}},
+			// never used, the route above matches first
+			{Consumer: other, Types: []string{Profile}},
+		},
+		Default: other,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	setLogger(c, &instanceLogger{level: GELogLevelOff})
+
+	d := Data{ClientId: "client", EventList: []EventListItem{
+		{Type: Track, EventName: "$AdShow"},
+		{Type: Profile, EventName: UserSet},
+		{Type: Track, EventName: "login"},
+		{Type: Track, EventName: "install"},
+		{Type: Profile, EventName: UserIncrement},
+		{Type: Track, EventName: "$Pay"},
+	}}
+	if err := c.Add(d); err != nil {
+		t.Fatal(err)
+	}
+	vipData := Data{ClientId: "vip_1", EventList: []EventListItem{{Type: Track, EventName: "$AdShow"}, {Type: Profile, EventName: UserSet}}}
+	if err := c.Add(vipData); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, tc := range map[string]struct {
+		consumer *recordConsumer
+		expected string
+	}{
+		"ads":      {ads, "$AdShow,install"},
+		"profiles": {profiles, UserSet + "," + UserIncrement + "|" + UserSet},
+		"vip":      {vip, "$AdShow"},
+		"default":  {other, "login,$Pay"},
+	} {
+		if got := strings.Join(eventNames(tc.consumer), "|"); got != tc.expected {
+			t.Errorf("%s received %s, want %s", name, got, tc.expected)
+		}
+	}
+}
+
+func TestRouterNoRoute(t *testing.T) {
+	routed := &recordConsumer{}
+	c, err := NewRouterConsumer(GERouterConfig{Routes: []GERoute{{Consumer: routed, Types: []string{Track}}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	setLogger(c, &instanceLogger{level: GELogLevelOff})
+
+	d := Data{ClientId: "client", EventList: []EventListItem{
+		{Type: Track, EventName: "login"},
+		{Type: Profile, EventName: UserSet},
+	}}
+	if err := c.Add(d); !errors.Is(err, ErrNoRoute) {
+		t.Fatalf("partially unrouted data: %v", err)
+	}
+	if got := strings.Join(eventNames(routed), "|"); got != "login" {
+		t.Fatalf("the routed items are not added: %s", got)
+	}
+}
+
+func TestRouterInvalidConfig(t *testing.T) {
+	for name, config := range map[string]GERouterConfig{
+		"empty":       {},
+		"nil":         {Routes: []GERoute{{}}},
+		"bad pattern": {Routes: []GERoute{{Consumer: &recordConsumer{}, EventNames: []string{"[a"}}}},
+	} {
+		if _, err := NewRouterConsumer(config); !errors.Is(err, ErrInvalidConfig) {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+}
+
+// A consumer used by several routes is flushed and closed once.
+func TestRouterClosesConsumerOnce(t *testing.T) {
+	shared := &countingCloser{}
+	c, err := NewRouterConsumer(GERouterConfig{
+		Routes:  []GERoute{{Consumer: shared, Types: []string{Track}}},
+		Default: shared,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if shared.closes != 1 {
+		t.Fatalf("closed %d times", shared.closes)
+	}
+}
+
+type countingCloser struct {
+	recordConsumer
+	closes int
+}
+
+func (c *countingCloser) Close() error {
+	c.closes++
+	return nil
+}
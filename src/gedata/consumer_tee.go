@@ -0,0 +1,170 @@
+package gedata
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+type TeeMode int32
+
+const (
+	TeeModeRequireAll TeeMode = 0 // call every consumer, fail if any of them fails
+	TeeModeBestEffort TeeMode = 1 // call every consumer, fail only if all of them fail
+	TeeModeFailFast   TeeMode = 2 // call consumers in order, stop at the first failure
+)
+
+// GETeeConsumer forward data to several consumers, e.g. GEBatchConsumer and GELogConsumer as local archive.
+type GETeeConsumer struct {
+	consumers []GEContextConsumer
+	mode      TeeMode
+	loggerHolder
+}
+
+type GETeeConfig struct {
+	Consumers []GEConsumer
+	Mode      TeeMode
+}
+
+// TeeError holds the errors of the consumers, indexed as the consumers passed to the tee consumer.
+// Consumers which succeeded or were not called have a nil error.
+type TeeError struct {
+	Errors []error
+}
+
+func (e *TeeError) Error() string {
+	var msgs []string
+	for i, err := range e.Errors {
+		if err != nil {
+			msgs = append(msgs, fmt.Sprintf("consumer %d: %v", i, err))
+		}
+	}
+	return "tee consumer failed: " + strings.Join(msgs, "; ")
+}
+
+func (e *TeeError) Unwrap() []error {
+	var errs []error
+	for _, err := range e.Errors {
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+// NewTeeConsumer create GETeeConsumer with TeeModeRequireAll
+func NewTeeConsumer(consumers ...GEConsumer) (GEConsumer, error) {
+	return NewTeeConsumerWithConfig(GETeeConfig{Consumers: consumers})
+}
+
+func NewTeeConsumerWithConfig(config GETeeConfig) (GEConsumer, error) {
+	if len(config.Consumers) == 0 {
+		err := fmt.Errorf("%w: tee consumer needs at least one consumer", ErrInvalidConfig)
+		geLogError(err.Error())
+		return nil, err
+	}
+	switch config.Mode {
+	case TeeModeRequireAll, TeeModeBestEffort, TeeModeFailFast:
+	default:
+		err := fmt.Errorf("%w: unknown tee mode %d", ErrInvalidConfig, config.Mode)
+		geLogError(err.Error())
+		return nil, err
+	}
+
+	c := &GETeeConsumer{
+		consumers: make([]GEContextConsumer, 0, len(config.Consumers)),
+		mode:      config.Mode,
+	}
+	c.initLogger("tee", nil)
+	for i, consumer := range config.Consumers {
+		if consumer == nil {
+			err := fmt.Errorf("%w: consumer %d of tee consumer is nil", ErrInvalidConfig, i)
+			geLogError(err.Error())
+			return nil, err
+		}
+		c.consumers = append(c.consumers, toContextConsumer(consumer))
+	}
+
+	c.logger().info("Mode: tee consumer, consumers: %d", len(c.consumers))
+
+	return c, nil
+}
+
+func (c *GETeeConsumer) Add(d Data) error {
+	return c.AddCtx(context.Background(), d)
+}
+
+func (c *GETeeConsumer) AddCtx(ctx context.Context, d Data) error {
+	return c.forward(c.mode, func(consumer GEContextConsumer) error {
+		return consumer.AddCtx(ctx, d)
+	})
+}
+
+func (c *GETeeConsumer) Flush() error {
+	return c.FlushCtx(context.Background())
+}
+
+func (c *GETeeConsumer) FlushCtx(ctx context.Context) error {
+	return c.forward(c.mode, func(consumer GEContextConsumer) error {
+		return consumer.FlushCtx(ctx)
+	})
+}
+
+func (c *GETeeConsumer) Close() error {
+	return c.CloseCtx(context.Background())
+}
+
+// CloseCtx close every consumer regardless of the mode, so that no consumer is leaked.
+func (c *GETeeConsumer) CloseCtx(ctx context.Context) error {
+	c.logger().info("tee consumer close")
+	mode := c.mode
+	if mode == TeeModeFailFast {
+		mode = TeeModeRequireAll
+	}
+	return c.forward(mode, func(consumer GEContextConsumer) error {
+		return consumer.CloseCtx(ctx)
+	})
+}
+
+// SetDropHandler install handler to every consumer which supports GEDropNotifier.
+func (c *GETeeConsumer) SetDropHandler(handler DropHandler) {
+	for _, consumer := range c.consumers {
+		setDropHandler(consumer, handler)
+	}
+}
+
+func (c *GETeeConsumer) setLogger(l *instanceLogger) {
+	c.loggerHolder.setLogger(l)
+	for _, consumer := range c.consumers {
+		setLogger(consumer, l)
+	}
+}
+
+// IsStringent is true if any of the consumers is stringent, so that data is acceptable for all of them.
+func (c *GETeeConsumer) IsStringent() bool {
+	for _, consumer := range c.consumers {
+		if consumer.IsStringent() {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *GETeeConsumer) forward(mode TeeMode, action func(consumer GEContextConsumer) error) error {
+	errs := make([]error, len(c.consumers))
+	failed := 0
+	for i, consumer := range c.consumers {
+		if err := action(consumer); err != nil {
+			c.logger().error("tee consumer %d failed: %v", i, err)
+			errs[i] = err
+			failed++
+			if mode == TeeModeFailFast {
+				break
+			}
+		}
+	}
+	if failed == 0 || (mode == TeeModeBestEffort && failed < len(c.consumers)) {
+		return nil
+	}
+	return &TeeError{Errors: errs}
+}
@@ -0,0 +1,102 @@
+package gedata
+
+import (
+	"errors"
+	"testing"
+)
+
+// failingConsumer record the data added to it, and fail with err if it is set.
+type failingConsumer struct {
+	recordConsumer
+	err    error
+	closed bool
+}
+
+func (c *failingConsumer) Add(d Data) error {
+	if c.err != nil {
+		return c.err
+	}
+	return c.recordConsumer.Add(d)
+}
+
+func (c *failingConsumer) Close() error {
+	c.closed = true
+	return c.err
+}
+
+func TestTeeModes(t *testing.T) {
+	errFirst, errSecond := errors.New("first failed"), errors.New("second failed")
+	d := Data{ClientId: "client", EventList: []EventListItem{{Type: Track, EventName: "event"}}}
+	for _, tc := range []struct {
+		name     string
+		mode     TeeMode
+		errs     []error // error of every consumer
+		called   []bool  // whether every consumer receives the data
+		expected []error // errors of TeeError, nil if Add succeeds
+	}{
+		{"require all succeeds", TeeModeRequireAll, []error{nil, nil}, []bool{true, true}, nil},
+		{"require all fails", TeeModeRequireAll, []error{errFirst, nil, errSecond}, []bool{false, true, false}, []error{errFirst, nil, errSecond}},
+		{"best effort partially fails", TeeModeBestEffort, []error{errFirst, nil}, []bool{false, true}, nil},
+		{"best effort all fail", TeeModeBestEffort, []error{errFirst, errSecond}, []bool{false, false}, []error{errFirst, errSecond}},
+		{"fail fast stops", TeeModeFailFast, []error{nil, errFirst, nil}, []bool{true, false, false}, []error{nil, errFirst, nil}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			consumers := make([]*failingConsumer, len(tc.errs))
+			config := GETeeConfig{Mode: tc.mode}
+			for i, err := range tc.errs {
+				consumers[i] = &failingConsumer{err: err}
+				config.Consumers = append(config.Consumers, consumers[i])
+			}
+			c, err := NewTeeConsumerWithConfig(config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			setLogger(c, &instanceLogger{level: GELogLevelOff})
+
+			err = c.Add(d)
+			for i, consumer := range consumers {
+				if called := len(consumer.data) > 0; called != tc.called[i] {
+					t.Errorf("consumer %d received data: %v", i, called)
+				}
+			}
+			if tc.expected == nil {
+				if err != nil {
+					t.Fatal(err)
+				}
+			} else {
+				var teeErr *TeeError
+				if !errors.As(err, &teeErr) {
+					t.Fatalf("not a TeeError: %v", err)
+				}
+				for i := range tc.expected {
+					if teeErr.Errors[i] != tc.expected[i] {
+						t.Errorf("error of consumer %d: %v, want %v", i, teeErr.Errors[i], tc.expected[i])
+					}
+				}
+				for _, e := range tc.expected {
+					if e != nil && !errors.Is(err, e) {
+						t.Errorf("TeeError does not wrap %v", e)
+					}
+				}
+			}
+
+			// every consumer is closed regardless of the mode
+			_ = c.Close()
+			for i, consumer := range consumers {
+				if !consumer.closed {
+					t.Errorf("consumer %d is not closed", i)
+				}
+			}
+		})
+	}
+}
+
+func TestTeeErrorMessage(t *testing.T) {
+	err := &TeeError{Errors: []error{nil, ErrChannelFull, ErrConsumerClosed}}
+	if msg := err.Error(); msg != "tee consumer failed: consumer 1: "+ErrChannelFull.Error()+"; consumer 2: "+ErrConsumerClosed.Error() {
+		t.Fatalf("unexpected message: %s", msg)
+	}
+	if !errors.Is(err, ErrChannelFull) || !errors.Is(err, ErrConsumerClosed) || errors.Is(err, ErrCacheFull) {
+		t.Fatal("TeeError does not wrap exactly the errors of the consumers")
+	}
+}
@@ -0,0 +1,138 @@
+package gedata
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// testConsumers create every kind of consumer, sending to a receiver which accepts everything.
+func testConsumers(t *testing.T) map[string]func() GEConsumer {
+	t.Helper()
+	url := newTestServer(t).URL
+	batch := func() GEConsumer {
+		return newTestBatchConsumer(t, GEBatchConfig{ServerUrl: url, BatchSize: 10})
+	}
+	log := func() GEConsumer {
+		c, err := NewLogConsumer(t.TempDir(), ROTATE_DAILY)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+	return map[string]func() GEConsumer{
+		"batch": batch,
+		"log":   log,
+		"debug": func() GEConsumer {
+			c, err := NewDebugConsumer(url)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return c
+		},
+		"tee": func() GEConsumer {
+			c, err := NewTeeConsumer(batch(), log())
+			if err != nil {
+				t.Fatal(err)
+			}
+			return c
+		},
+		"router": func() GEConsumer {
+			c, err := NewRouterConsumer(GERouterConfig{
+				Routes:  []GERoute{{Consumer: batch(), Types: []string{Track}}},
+				Default: log(),
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			return c
+		},
+	}
+}
+
+// Track, Flush and Add of the consumer race with Close, they either succeed or fail with ErrConsumerClosed.
+// Run with -race.
+func TestCloseRacesWithTrackAndFlush(t *testing.T) {
+	for name, newConsumer := range testConsumers(t) {
+		t.Run(name, func(t *testing.T) {
+			c := newConsumer()
+			ge := New(c, WithLogLevel(GELogLevelOff))
+			check := func(err error) {
+				if err != nil && !errors.Is(err, ErrConsumerClosed) {
+					t.Error(err)
+				}
+			}
+
+			var wg sync.WaitGroup
+			start := make(chan struct{})
+			for i := 0; i < 4; i++ {
+				wg.Add(3)
+				go func() {
+					defer wg.Done()
+					<-start
+					for j := 0; j < 50; j++ {
+						check(ge.Track("client", "event", map[string]interface{}{"index": j}))
+					}
+				}()
+				go func() {
+					defer wg.Done()
+					<-start
+					for j := 0; j < 10; j++ {
+						check(ge.Flush())
+					}
+				}()
+				go func() {
+					defer wg.Done()
+					<-start
+					for j := 0; j < 50; j++ {
+						check(c.Add(Data{ClientId: "client", EventList: []EventListItem{{Type: Track, EventName: "event"}}}))
+					}
+				}()
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				<-start
+				check(ge.Close())
+			}()
+			close(start)
+			wg.Wait()
+
+			err := ge.Track("client", "event", nil)
+			if !errors.Is(err, ErrConsumerClosed) {
+				t.Fatalf("Track after Close: %v", err)
+			}
+			if strings.Count(err.Error(), "closed") != 1 {
+				t.Fatalf("redundant error: %v", err)
+			}
+			if err := ge.Flush(); !errors.Is(err, ErrConsumerClosed) {
+				t.Fatalf("Flush after Close: %v", err)
+			}
+		})
+	}
+}
+
+func TestCloseTwice(t *testing.T) {
+	for name, newConsumer := range testConsumers(t) {
+		t.Run(name, func(t *testing.T) {
+			c := newConsumer()
+			ge := New(c, WithLogLevel(GELogLevelOff))
+			if err := ge.Track("client", "event", nil); err != nil {
+				t.Fatal(err)
+			}
+			for i := 0; i < 2; i++ {
+				if err := ge.Close(); err != nil {
+					t.Fatalf("Close %d: %v", i+1, err)
+				}
+			}
+			if err := c.Close(); err != nil {
+				t.Fatalf("Close of consumer: %v", err)
+			}
+			d := Data{ClientId: "client", EventList: []EventListItem{{Type: Track, EventName: "event"}}}
+			if err := c.Add(d); !errors.Is(err, ErrConsumerClosed) {
+				t.Fatalf("Add after Close: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package gedata
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// A done ctx fails TrackCtx, FlushCtx and CloseCtx of every consumer, and a later Close succeeds.
+func TestDoneContext(t *testing.T) {
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	expired, cancelExpired := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancelExpired()
+
+	for name, newConsumer := range testConsumers(t) {
+		for _, ctx := range []context.Context{cancelled, expired} {
+			t.Run(name+"/"+ctx.Err().Error(), func(t *testing.T) {
+				ge := New(newConsumer(), WithLogLevel(GELogLevelOff))
+				var notified int
+				ge.OnError(func(d Data, err error) {
+					notified++
+				})
+				if err := ge.TrackCtx(ctx, "client", "event", nil); !errors.Is(err, ctx.Err()) {
+					t.Errorf("TrackCtx: %v", err)
+				}
+				if err := ge.UserSetCtx(ctx, "client", map[string]interface{}{"level": 1}); !errors.Is(err, ctx.Err()) {
+					t.Errorf("UserSetCtx: %v", err)
+				}
+				if err := ge.FlushCtx(ctx); !errors.Is(err, ctx.Err()) {
+					t.Errorf("FlushCtx: %v", err)
+				}
+				if err := ge.CloseCtx(ctx); !errors.Is(err, ctx.Err()) {
+					t.Errorf("CloseCtx: %v", err)
+				}
+				if notified != 4 {
+					t.Errorf("OnError is notified %d times", notified)
+				}
+				if err := ge.Close(); err != nil {
+					t.Fatalf("Close after CloseCtx failed: %v", err)
+				}
+			})
+		}
+	}
+}
+
+// AddCtx of GELogConsumer waits for free space of a full channel until ctx is done, Add fails immediately.
+func TestLogConsumerWaitsForChannel(t *testing.T) {
+	c, err := NewLogConsumerWithConfig(GELogConsumerConfig{Directory: t.TempDir(), ChannelSize: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	gate := make(chan struct{})
+	setLogger(c, &instanceLogger{leveled: blockingLogger{gate: gate}})
+	var drops int
+	c.(GEDropNotifier).SetDropHandler(func(d Data, reason DropReason, err error) {
+		if reason == DropReasonChannelFull {
+			drops++
+		}
+	})
+	d := Data{ClientId: "client", EventList: []EventListItem{{Type: Track, EventName: "event"}}}
+
+	// the first data blocks the writer, the second one fills the channel
+	if err := c.Add(d); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "channel filled", func() {
+		for len(c.(*GELogConsumer).ch) > 0 {
+			time.Sleep(time.Millisecond)
+		}
+		if err := c.Add(d); err != nil {
+			t.Error(err)
+		}
+	})
+
+	if err := c.Add(d); !errors.Is(err, ErrChannelFull) {
+		t.Fatalf("Add to a full channel: %v", err)
+	}
+	const timeout = 50 * time.Millisecond
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	start := time.Now()
+	err = c.(GEContextConsumer).AddCtx(ctx, d)
+	if !errors.Is(err, ErrChannelFull) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("AddCtx to a full channel: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < timeout {
+		t.Fatalf("AddCtx returns after %v, before ctx is done", elapsed)
+	}
+	if drops != 2 {
+		t.Fatalf("dropped %d, want 2", drops)
+	}
+
+	// AddCtx succeeds once the writer frees the channel
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	time.AfterFunc(10*time.Millisecond, func() { close(gate) })
+	if err := c.(GEContextConsumer).AddCtx(ctx, d); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
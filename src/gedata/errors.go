@@ -0,0 +1,64 @@
+package gedata
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+var (
+	ErrEmptyEventName   = errors.New("the event name must be provided")
+	ErrConsumerClosed   = errors.New("SDK has been closed")
+	ErrChannelFull      = errors.New("channel is full")
+	ErrInvalidProperty  = errors.New("invalid property")
+	ErrInvalidConfig    = errors.New("invalid config")
+	ErrSchemaViolation  = errors.New("schema violation")
+	ErrInvalidOperation = errors.New("unknown profile operation")
+	ErrNoRoute          = errors.New("no route matches the data")
+	ErrPanicRecovered   = errors.New("panic recovered")
+	ErrCacheFull        = errors.New("cache is full")
+	ErrProfileConflict  = errors.New("conflicting profile operations")
+
+	// ErrDropEvent can be returned by an Interceptor to drop the event without error.
+	ErrDropEvent = errors.New("event dropped by interceptor")
+)
+
+// ReceiverError is returned when the receiver does not accept the data.
+// Errors of the http client (e.g. *url.Error) are returned as they are.
+type ReceiverError struct {
+	StatusCode int    // http status code
+	Code       int    // code of response body, -1 if the body is not parsed
+	Msg        string // msg of response body
+}
+
+func (e *ReceiverError) Error() string {
+	return fmt.Sprintf("send to receiver failed, status code: %d, code: %d, msg: %s", e.StatusCode, e.Code, e.Msg)
+}
+
+// Rejected reports whether the receiver handled the request but refused the data, retry would not help.
+func (e *ReceiverError) Rejected() bool {
+	return e.StatusCode == http.StatusOK && e.Code != 0
+}
+
+// InterceptorError is returned when an Interceptor rejects the event.
+type InterceptorError struct {
+	Index int // index of the interceptor in registration order
+	Err   error
+}
+
+func (e *InterceptorError) Error() string {
+	return fmt.Sprintf("rejected by interceptor %d: %v", e.Index, e.Err)
+}
+
+func (e *InterceptorError) Unwrap() error {
+	return e.Err
+}
+
+// isDataError reports whether err is caused by the data itself, so that retry would not help.
+func isDataError(err error) bool {
+	var receiverErr *ReceiverError
+	if errors.As(err, &receiverErr) && receiverErr.Rejected() {
+		return true
+	}
+	return errors.Is(err, ErrInvalidProperty)
+}
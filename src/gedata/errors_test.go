@@ -0,0 +1,121 @@
+package gedata
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func TestSentinelErrors(t *testing.T) {
+	ge := New(&recordConsumer{stringent: true}, WithLogLevel(GELogLevelOff))
+	errBlocked := errors.New("blocked")
+	ge.Use(func(item *EventListItem, clientId string) error {
+		if item.EventName == "blocked" {
+			return errBlocked
+		}
+		return nil
+	})
+	_, configErr := NewBatchConsumerWithConfig(GEBatchConfig{})
+	for _, tc := range []struct {
+		name     string
+		err      error
+		sentinel error
+	}{
+		{"empty event name", ge.Track("client", "", nil), ErrEmptyEventName},
+		{"invalid property", ge.Track("client", "event", map[string]interface{}{"1key": 1}), ErrInvalidProperty},
+		{"invalid operation", ge.UserMany("client", []ProfileItem{{Operation: "user_unknown"}}), ErrInvalidOperation},
+		{"profile conflict", ge.ProfileUpdate("client").Set("a", 1).Unset("a").Submit(), ErrProfileConflict},
+		{"invalid config", configErr, ErrInvalidConfig},
+		{"interceptor", ge.Track("client", "blocked", nil), errBlocked},
+	} {
+		if !errors.Is(tc.err, tc.sentinel) {
+			t.Errorf("%s: %v is not %v", tc.name, tc.err, tc.sentinel)
+		}
+	}
+
+	err := ge.Track("client", "blocked", nil)
+	var interceptorErr *InterceptorError
+	if !errors.As(err, &interceptorErr) || interceptorErr.Index != 0 || interceptorErr.Err != errBlocked {
+		t.Errorf("not an InterceptorError: %v", err)
+	}
+
+	if err := ge.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := ge.Track("client", "event", nil); !errors.Is(err, ErrConsumerClosed) {
+		t.Errorf("Track after Close: %v", err)
+	}
+}
+
+func TestReceiverErrorRejected(t *testing.T) {
+	for _, tc := range []struct {
+		err      ReceiverError
+		rejected bool
+	}{
+		{ReceiverError{StatusCode: http.StatusOK, Code: 1, Msg: "invalid"}, true},
+		{ReceiverError{StatusCode: http.StatusOK, Code: 0}, false},
+		{ReceiverError{StatusCode: http.StatusInternalServerError, Code: -1}, false},
+		{ReceiverError{StatusCode: http.StatusBadGateway, Code: 1}, false},
+	} {
+		if tc.err.Rejected() != tc.rejected {
+			t.Errorf("%v: Rejected() = %v", tc.err.Error(), !tc.rejected)
+		}
+		wrapped := fmt.Errorf("flush: %w", &tc.err)
+		if isDataError(wrapped) != tc.rejected {
+			t.Errorf("%v: isDataError() = %v", tc.err.Error(), !tc.rejected)
+		}
+	}
+	if !isDataError(fmt.Errorf("%w: bad value", ErrInvalidProperty)) || isDataError(ErrChannelFull) {
+		t.Error("isDataError of sentinels")
+	}
+}
+
+// Flush stops at data rejected by receiver, FlushAll drops it and goes on, but both stop at other errors.
+func TestFlushAllSkipsDataErrors(t *testing.T) {
+	var down atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+		if down.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte(`{"code":1,"msg":"rejected"}`))
+	}))
+	defer server.Close()
+	c := newTestBatchConsumer(t, GEBatchConfig{ServerUrl: server.URL})
+	var rejected atomic.Int32
+	c.(GEDropNotifier).SetDropHandler(func(d Data, reason DropReason, err error) {
+		if reason == DropReasonRejected {
+			rejected.Add(1)
+		}
+	})
+	batch := c.(*GEBatchConsumer)
+	d := Data{ClientId: "client", EventList: []EventListItem{{Type: Track, EventName: "event"}}}
+
+	_ = c.Add(d)
+	var receiverErr *ReceiverError
+	if err := c.Flush(); !errors.As(err, &receiverErr) || !receiverErr.Rejected() {
+		t.Fatalf("Flush of rejected data: %v", err)
+	}
+	_ = c.Add(d)
+	if err := batch.FlushAll(); err != nil {
+		t.Fatalf("FlushAll of rejected data: %v", err)
+	}
+
+	down.Store(true)
+	_ = c.Add(d)
+	if err := batch.FlushAll(); !errors.As(err, &receiverErr) || receiverErr.Rejected() || isDataError(err) {
+		t.Fatalf("FlushAll while receiver is down: %v", err)
+	}
+	down.Store(false)
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if rejected.Load() != 3 {
+		t.Fatalf("rejected %d, want 3", rejected.Load())
+	}
+}
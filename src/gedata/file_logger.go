@@ -0,0 +1,172 @@
+package gedata
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const fileLoggerDateFormat = "2006-01-02"
+
+// GEFileLoggerConfig configures GEFileLogger.
+type GEFileLoggerConfig struct {
+	Path     string // path of the log file, the date and the index are appended, e.g. /var/log/ge_sdk.log.2025-05-16_0
+	FileSize int    // max size of single log file (MByte), 0 means the file is only rotated by day
+	MaxDays  int    // days the log files are kept including today, e.g. 1 keeps only today, 0 means they are kept forever
+}
+
+// GEFileLogger write the diagnostic logs of SDK to files rotated by day and size. It can be set by
+// SetLoggerConfig, SetCustomLogger or WithLogger.
+type GEFileLogger struct {
+	path        string
+	fileSize    int64
+	maxDays     int
+	mutex       *sync.Mutex
+	currentFile *os.File
+	day         string // date of currentFile
+	index       int    // index of currentFile for size-based rotation
+	size        int64  // size of currentFile
+	closed      bool
+	clock       func() time.Time
+}
+
+// NewFileLogger create GEFileLogger, the directory of Path is created if it does not exist.
+func NewFileLogger(config GEFileLoggerConfig) (*GEFileLogger, error) {
+	if config.Path == "" {
+		return nil, fmt.Errorf("%w: Path of file logger must not be empty", ErrInvalidConfig)
+	}
+	if config.FileSize < 0 || config.MaxDays < 0 {
+		return nil, fmt.Errorf("%w: FileSize and MaxDays of file logger must not be negative", ErrInvalidConfig)
+	}
+	if err := os.MkdirAll(filepath.Dir(config.Path), 0750); err != nil {
+		return nil, err
+	}
+	l := &GEFileLogger{
+		path:     config.Path,
+		fileSize: int64(config.FileSize) * 1024 * 1024,
+		maxDays:  config.MaxDays,
+		mutex:    new(sync.Mutex),
+		clock:    time.Now,
+	}
+	if err := l.rotate(l.clock()); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Print write message with the current time. Errors are printed on console, since they can not be logged.
+func (l *GEFileLogger) Print(message string) {
+	now := l.clock()
+	line := fmt.Sprintf("[%v]%s", now.Format("2006-01-02 15:04:05.000"), message)
+	if !strings.HasSuffix(line, "\n") {
+		line += "\n"
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.closed {
+		return
+	}
+	if l.currentFile == nil || l.day != now.Format(fileLoggerDateFormat) || (l.fileSize > 0 && l.size >= l.fileSize) {
+		if err := l.rotate(now); err != nil {
+			fmt.Println(SDK_LOG_PREFIX + "rotate log file failed: " + err.Error())
+			return
+		}
+	}
+	n, err := l.currentFile.WriteString(line)
+	l.size += int64(n)
+	if err != nil {
+		fmt.Println(SDK_LOG_PREFIX + "write log file failed: " + err.Error())
+	}
+}
+
+// Close close the current file, messages printed afterwards are discarded.
+func (l *GEFileLogger) Close() error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.closed = true
+	if l.currentFile == nil {
+		return nil
+	}
+	err := l.currentFile.Close()
+	l.currentFile = nil
+	return err
+}
+
+// rotate open the file for now, it continues with the last file of the day if it is not full.
+func (l *GEFileLogger) rotate(now time.Time) error {
+	day := now.Format(fileLoggerDateFormat)
+	index := 0
+	if day == l.day {
+		index = l.index + 1
+	}
+	for l.fileSize > 0 {
+		stat, err := os.Stat(l.fileName(day, index))
+		if err != nil || stat.Size() < l.fileSize {
+			break
+		}
+		index++
+	}
+
+	fd, err := os.OpenFile(l.fileName(day, index), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0664)
+	if err != nil {
+		return err
+	}
+	stat, err := fd.Stat()
+	if err != nil {
+		_ = fd.Close()
+		return err
+	}
+	if l.currentFile != nil {
+		_ = l.currentFile.Close()
+	}
+	newDay := day != l.day
+	l.currentFile = fd
+	l.day = day
+	l.index = index
+	l.size = stat.Size()
+
+	if newDay {
+		l.removeExpired(now)
+	}
+	return nil
+}
+
+func (l *GEFileLogger) fileName(day string, index int) string {
+	// is need paging
+	if l.fileSize > 0 {
+		return fmt.Sprintf("%s.%s_%d", l.path, day, index)
+	}
+	return fmt.Sprintf("%s.%s", l.path, day)
+}
+
+// removeExpired remove the files of the days before the last maxDays days, today included.
+func (l *GEFileLogger) removeExpired(now time.Time) {
+	if l.maxDays <= 0 {
+		return
+	}
+	prefix := filepath.Base(l.path) + "."
+	entries, err := os.ReadDir(filepath.Dir(l.path))
+	if err != nil {
+		fmt.Println(SDK_LOG_PREFIX + "read log directory failed: " + err.Error())
+		return
+	}
+	today, _ := time.ParseInLocation(fileLoggerDateFormat, now.Format(fileLoggerDateFormat), now.Location())
+	expiry := today.AddDate(0, 0, 1-l.maxDays)
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, prefix) || len(name) < len(prefix)+len(fileLoggerDateFormat) {
+			continue
+		}
+		day, err := time.ParseInLocation(fileLoggerDateFormat, name[len(prefix):len(prefix)+len(fileLoggerDateFormat)], now.Location())
+		if err != nil || !day.Before(expiry) {
+			continue
+		}
+		if err := os.Remove(filepath.Join(filepath.Dir(l.path), name)); err != nil {
+			fmt.Println(SDK_LOG_PREFIX + "remove expired log file failed: " + err.Error())
+		}
+	}
+}
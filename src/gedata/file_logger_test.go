@@ -0,0 +1,143 @@
+package gedata
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// logFiles return the names of the files in dir, sorted.
+func logFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	sort.Strings(names)
+	return names
+}
+
+func newTestFileLogger(t *testing.T, config GEFileLoggerConfig, now *time.Time) *GEFileLogger {
+	t.Helper()
+	l, err := NewFileLogger(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.clock = func() time.Time { return *now }
+	t.Cleanup(func() { _ = l.Close() })
+	return l
+}
+
+func TestFileLoggerRotateBySize(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	day := now.Format(fileLoggerDateFormat)
+	l := newTestFileLogger(t, GEFileLoggerConfig{Path: filepath.Join(dir, "ge.log"), FileSize: 1}, &now)
+
+	message := strings.Repeat("x", 400*1024)
+	for i := 0; i < 6; i++ {
+		l.Print(message)
+	}
+	expected := []string{"ge.log." + day + "_0", "ge.log." + day + "_1"}
+	if files := logFiles(t, dir); strings.Join(files, ",") != strings.Join(expected, ",") {
+		t.Fatalf("files %v, want %v", files, expected)
+	}
+}
+
+func TestFileLoggerRotateByDay(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Date(2024, 1, 1, 23, 59, 59, 0, time.Local)
+	l := newTestFileLogger(t, GEFileLoggerConfig{Path: filepath.Join(dir, "ge.log"), FileSize: 1}, &now)
+
+	l.Print("first day")
+	now = now.Add(time.Second)
+	l.Print("second day")
+	now = now.AddDate(0, 0, 1)
+	l.Print("third day")
+
+	// the first file is named by the real time when the logger is created
+	files := strings.Join(logFiles(t, dir), ",")
+	for _, name := range []string{"ge.log.2024-01-01_0", "ge.log.2024-01-02_0", "ge.log.2024-01-03_0"} {
+		if !strings.Contains(files, name) {
+			t.Fatalf("%s is not created: %v", name, files)
+		}
+	}
+	content, err := os.ReadFile(filepath.Join(dir, "ge.log.2024-01-02_0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(content), "second day") || strings.Contains(string(content), "third day") {
+		t.Fatalf("content of the second day: %q", content)
+	}
+}
+
+// A new logger continues with the last file of the day which is not full.
+func TestFileLoggerContinuesLastFile(t *testing.T) {
+	dir := t.TempDir()
+	day := time.Now().Format(fileLoggerDateFormat)
+	path := filepath.Join(dir, "ge.log")
+	if err := os.WriteFile(path+"."+day+"_0", make([]byte, 1024*1024), 0664); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path+"."+day+"_1", []byte("existing\n"), 0664); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	l := newTestFileLogger(t, GEFileLoggerConfig{Path: path, FileSize: 1}, &now)
+	l.Print("appended")
+	content, err := os.ReadFile(path + "." + day + "_1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(content), "existing\n") || !strings.Contains(string(content), "appended") {
+		t.Fatalf("content of the last file: %q", content)
+	}
+	if files := logFiles(t, dir); len(files) != 2 {
+		t.Fatalf("files: %v", files)
+	}
+}
+
+// MaxDays is the count of days whose files are kept, today included.
+func TestFileLoggerMaxDays(t *testing.T) {
+	today := time.Now()
+	for _, tc := range []struct {
+		maxDays int
+		kept    int // days kept before today
+	}{
+		{1, 0},
+		{2, 1},
+		{0, 3},
+	} {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "ge.log")
+		for i := 1; i <= 3; i++ {
+			name := path + "." + today.AddDate(0, 0, -i).Format(fileLoggerDateFormat)
+			if err := os.WriteFile(name, nil, 0664); err != nil {
+				t.Fatal(err)
+			}
+		}
+		for _, name := range []string{"other.log", "ge.log.invalid-date"} {
+			if err := os.WriteFile(filepath.Join(dir, name), nil, 0664); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		newTestFileLogger(t, GEFileLoggerConfig{Path: path, MaxDays: tc.maxDays}, &today)
+		expected := []string{"ge.log.invalid-date", "other.log", "ge.log." + today.Format(fileLoggerDateFormat)}
+		for i := 1; i <= tc.kept; i++ {
+			expected = append(expected, "ge.log."+today.AddDate(0, 0, -i).Format(fileLoggerDateFormat))
+		}
+		sort.Strings(expected)
+		if files := logFiles(t, dir); strings.Join(files, ",") != strings.Join(expected, ",") {
+			t.Errorf("MaxDays %d: files %v, want %v", tc.maxDays, files, expected)
+		}
+	}
+}
@@ -2,13 +2,21 @@ package gedata
 
 import (
 	"fmt"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
 // SDK_LOG_PREFIX const
 const SDK_LOG_PREFIX = "[ge data]"
 
-var logInstance GELogger
+// logInstance holds the globalLogger set by SetCustomLogger or SetLoggerConfig.
+var logInstance atomic.Value
+
+// globalLogger wraps GELogger, since atomic.Value requires a consistent concrete type.
+type globalLogger struct {
+	GELogger
+}
 
 type GELogLevel int32
 
@@ -20,8 +28,20 @@ const (
 	GELogLevelDebug   GELogLevel = 5
 )
 
-// default is GELogLevelOff
-var currentLogLevel = GELogLevelOff
+// currentLogLevel is the GELogLevel set by SetLogLevel, 0 means the default GELogLevelOff.
+var currentLogLevel atomic.Int32
+
+func globalLogLevel() GELogLevel {
+	if level := GELogLevel(currentLogLevel.Load()); level != 0 {
+		return level
+	}
+	return GELogLevelOff
+}
+
+func globalCustomLogger() GELogger {
+	l, _ := logInstance.Load().(globalLogger)
+	return l.GELogger
+}
 
 // GELogger User-defined log classes must comply with interface
 type GELogger interface {
@@ -34,19 +54,113 @@ func SetLogLevel(level GELogLevel) {
 		fmt.Println(SDK_LOG_PREFIX + "log type error")
 		return
 	} else {
-		currentLogLevel = level
+		currentLogLevel.Store(int32(level))
 	}
 }
 
 // SetCustomLogger Set a custom log input class, usually you don't need to set it up.
 func SetCustomLogger(logger GELogger) {
 	if logger != nil {
-		logInstance = logger
+		logInstance.Store(globalLogger{logger})
+	}
+}
+
+// GELeveledLogger receives leveled messages with structured fields, it is set by WithLeveledLogger.
+// Unlike GELogger the message is not prefixed, and fields are not formatted into it.
+type GELeveledLogger interface {
+	Log(level GELogLevel, msg string, fields ...LogField)
+}
+
+// GELevelEnabler may be implemented by a GELeveledLogger, messages of the levels it disables are
+// dropped before they are formatted.
+type GELevelEnabler interface {
+	Enabled(level GELogLevel) bool
+}
+
+// LogField is a key-value pair attached to a log message.
+type LogField struct {
+	Key   string
+	Value interface{}
+}
+
+// keys of the fields attached by the SDK
+const (
+	LogFieldConsumer   = "consumer"    // kind of the consumer, e.g. batch, log
+	LogFieldClientId   = "client_id"   // client id of the data
+	LogFieldBatchSize  = "batch_size"  // number of events sent in one request
+	LogFieldStatusCode = "status_code" // http status code returned by receiver
+)
+
+func (l GELogLevel) String() string {
+	switch l {
+	case GELogLevelOff:
+		return "off"
+	case GELogLevelError:
+		return "error"
+	case GELogLevelWarning:
+		return "warning"
+	case GELogLevelInfo:
+		return "info"
+	case GELogLevelDebug:
+		return "debug"
+	default:
+		return "unknown"
 	}
 }
 
+// instanceLogger is the logger of a GEAnalytics or a consumer, it is immutable once created.
+// A nil instanceLogger, or its zero fields, fall back to SetLogLevel and SetCustomLogger.
+type instanceLogger struct {
+	level   GELogLevel      // 0 means the level set by SetLogLevel, or every level if leveled is set
+	logger  GELogger        // nil means the logger set by SetCustomLogger
+	leveled GELeveledLogger // takes precedence over logger
+	fields  []LogField
+}
+
 func geLog(level GELogLevel, format string, v ...interface{}) {
-	if level > currentLogLevel {
+	(*instanceLogger)(nil).log(level, format, v...)
+}
+
+// with return a logger which attaches fields to every message.
+func (l *instanceLogger) with(fields ...LogField) *instanceLogger {
+	result := &instanceLogger{}
+	if l != nil {
+		*result = *l
+	}
+	result.fields = make([]LogField, 0, len(result.fields)+len(fields))
+	if l != nil {
+		result.fields = append(result.fields, l.fields...)
+	}
+	result.fields = append(result.fields, fields...)
+	return result
+}
+
+func (l *instanceLogger) log(level GELogLevel, format string, v ...interface{}) {
+	current := globalLogLevel()
+	custom := globalCustomLogger()
+	var leveled GELeveledLogger
+	var fields []LogField
+	if l != nil {
+		leveled = l.leveled
+		if l.level != 0 {
+			current = l.level
+		} else if leveled != nil {
+			current = GELogLevelDebug
+		}
+		if l.logger != nil {
+			custom = l.logger
+		}
+		fields = l.fields
+	}
+	if level > current {
+		return
+	}
+
+	if leveled != nil {
+		if enabler, ok := leveled.(GELevelEnabler); ok && !enabler.Enabled(level) {
+			return
+		}
+		leveled.Log(level, fmt.Sprintf(format, v...), fields...)
 		return
 	}
 
@@ -69,15 +183,34 @@ func geLog(level GELogLevel, format string, v ...interface{}) {
 		break
 	}
 
-	if logInstance != nil {
-		msg := fmt.Sprintf(SDK_LOG_PREFIX+modeStr+format+"\n", v...)
-		logInstance.Print(msg)
+	msg := fmt.Sprintf(format, v...)
+	for _, field := range fields {
+		msg += fmt.Sprintf(" %s=%v", field.Key, field.Value)
+	}
+	if custom != nil {
+		custom.Print(SDK_LOG_PREFIX + modeStr + msg + "\n")
 	} else {
 		logTime := fmt.Sprintf("[%v]", time.Now().Format("2006-01-02 15:04:05.000"))
-		fmt.Printf(logTime+SDK_LOG_PREFIX+modeStr+format+"\n", v...)
+		fmt.Print(logTime + SDK_LOG_PREFIX + modeStr + msg + "\n")
 	}
 }
 
+func (l *instanceLogger) debug(format string, v ...interface{}) {
+	l.log(GELogLevelDebug, format, v...)
+}
+
+func (l *instanceLogger) info(format string, v ...interface{}) {
+	l.log(GELogLevelInfo, format, v...)
+}
+
+func (l *instanceLogger) error(format string, v ...interface{}) {
+	l.log(GELogLevelError, format, v...)
+}
+
+func (l *instanceLogger) warning(format string, v ...interface{}) {
+	l.log(GELogLevelWarning, format, v...)
+}
+
 func geLogDebug(format string, v ...interface{}) {
 	geLog(GELogLevelDebug, format, v...)
 }
@@ -94,10 +227,64 @@ func geLogWarning(format string, v ...interface{}) {
 	geLog(GELogLevelWarning, format, v...)
 }
 
-// Deprecated: please use gedata.SetLogLevel(gedata.GELogLevelOff)
+// loggerHolder is embedded by consumers, so that GEAnalytics can share its logger with them.
+// Messages of the consumer carry the LogFieldConsumer field.
+type loggerHolder struct {
+	consumer string
+	base     atomic.Pointer[instanceLogger] // logger shared with GEAnalytics
+	instance atomic.Pointer[instanceLogger] // base with the consumer field
+}
+
+// initLogger is called by the constructor of the consumer before anything is logged.
+func (h *loggerHolder) initLogger(consumer string, l *instanceLogger) {
+	h.consumer = consumer
+	h.setLogger(l)
+}
+
+func (h *loggerHolder) logger() *instanceLogger {
+	return h.instance.Load()
+}
+
+func (h *loggerHolder) baseLogger() *instanceLogger {
+	return h.base.Load()
+}
+
+func (h *loggerHolder) setLogger(l *instanceLogger) {
+	h.base.Store(l)
+	h.instance.Store(l.with(LogField{Key: LogFieldConsumer, Value: h.consumer}))
+}
+
+// loggerSetter is implemented by the consumers of this package.
+type loggerSetter interface {
+	baseLogger() *instanceLogger
+	setLogger(l *instanceLogger)
+}
+
+func unwrapConsumer(c GEConsumer) GEConsumer {
+	if a, ok := c.(contextConsumerAdapter); ok {
+		return a.GEConsumer
+	}
+	return c
+}
+
+// setLogger share l with the consumer if it is a consumer of this package.
+func setLogger(c GEConsumer, l *instanceLogger) {
+	if s, ok := unwrapConsumer(c).(loggerSetter); ok {
+		s.setLogger(l)
+	}
+}
+
+// consumerLogger return the logger of the consumer, nil if it has none.
+func consumerLogger(c GEConsumer) *instanceLogger {
+	if s, ok := unwrapConsumer(c).(loggerSetter); ok {
+		return s.baseLogger()
+	}
+	return nil
+}
+
+// LogType is the output of SDK logs set by SetLoggerConfig.
 type LogType int32
 
-// Deprecated: please use gedata.SetLogLevel(gedata.GELogLevelOff)
 const (
 	LoggerTypeOff               LogType = 1 << 0                                // disable log
 	LoggerTypePrint             LogType = 1 << 1                                // print on console
@@ -105,21 +292,70 @@ const (
 	LoggerTypePrintAndWriteFile         = LoggerTypePrint | LoggerTypeWriteFile // print both on console and file
 )
 
-// Deprecated: please use gedata.SetLogLevel(gedata.GELogLevelOff)
+// LoggerConfig configures the output of SDK logs, see GEFileLoggerConfig for the file options.
 type LoggerConfig struct {
-	Type LogType
-	Path string
+	Type     LogType
+	Path     string // path of the log file, required by LoggerTypeWriteFile
+	FileSize int    // max size of single log file (MByte), 0 means the file is only rotated by day
+	MaxDays  int    // days the log files are kept including today, e.g. 1 keeps only today, 0 means they are kept forever
 }
 
-// Deprecated: please use gedata.SetLogLevel(gedata.GELogLevelOff)
+var (
+	configMutex      sync.Mutex
+	configFileLogger *GEFileLogger // file logger created by SetLoggerConfig
+	configLogger     GELogger      // logger installed by SetLoggerConfig
+)
+
+// SetLoggerConfig set the output of SDK logs, the level is GELogLevelInfo unless the Type is LoggerTypeOff.
+// It replaces the logger set by SetCustomLogger if the Type includes LoggerTypeWriteFile.
 func SetLoggerConfig(config LoggerConfig) {
 	if config.Type < LoggerTypeOff || config.Type > LoggerTypePrintAndWriteFile {
 		fmt.Println(SDK_LOG_PREFIX + "log type error")
 		return
 	}
+
+	configMutex.Lock()
+	defer configMutex.Unlock()
+	if configFileLogger != nil {
+		// keep the logger set by SetCustomLogger in the meantime
+		logInstance.CompareAndSwap(globalLogger{configLogger}, globalLogger{})
+		_ = configFileLogger.Close()
+		configFileLogger = nil
+		configLogger = nil
+	}
+
 	if config.Type&LoggerTypeOff == LoggerTypeOff {
-		currentLogLevel = GELogLevelOff
-	} else {
-		currentLogLevel = GELogLevelInfo
+		currentLogLevel.Store(int32(GELogLevelOff))
+		return
+	}
+	currentLogLevel.Store(int32(GELogLevelInfo))
+
+	if config.Type&LoggerTypeWriteFile == LoggerTypeWriteFile {
+		fileLogger, err := NewFileLogger(GEFileLoggerConfig{
+			Path:     config.Path,
+			FileSize: config.FileSize,
+			MaxDays:  config.MaxDays,
+		})
+		if err != nil {
+			fmt.Println(SDK_LOG_PREFIX + "init log file failed: " + err.Error())
+			return
+		}
+		configFileLogger = fileLogger
+		configLogger = fileLogger
+		if config.Type&LoggerTypePrint == LoggerTypePrint {
+			configLogger = printAndFileLogger{file: fileLogger}
+		}
+		logInstance.Store(globalLogger{configLogger})
 	}
 }
+
+// printAndFileLogger print SDK logs both on console and file.
+type printAndFileLogger struct {
+	file *GEFileLogger
+}
+
+func (l printAndFileLogger) Print(message string) {
+	logTime := fmt.Sprintf("[%v]", time.Now().Format("2006-01-02 15:04:05.000"))
+	fmt.Print(logTime + message)
+	l.file.Print(message)
+}
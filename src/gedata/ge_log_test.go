@@ -0,0 +1,65 @@
+package gedata
+
+import (
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// The global log settings may be changed while the SDK logs. Run with -race.
+func TestGlobalLoggerConcurrentChange(t *testing.T) {
+	t.Cleanup(func() {
+		SetLoggerConfig(LoggerConfig{Type: LoggerTypeOff})
+		logInstance.Store(globalLogger{})
+		currentLogLevel.Store(0)
+	})
+
+	path := filepath.Join(t.TempDir(), "ge.log")
+	logger := &bufferLogger{}
+	var wg sync.WaitGroup
+	wg.Add(4)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			SetLogLevel(GELogLevelDebug)
+			SetLogLevel(GELogLevelOff)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			SetCustomLogger(logger)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 20; i++ {
+			SetLoggerConfig(LoggerConfig{Type: LoggerTypeWriteFile, Path: path})
+			SetLoggerConfig(LoggerConfig{Type: LoggerTypeOff})
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 500; i++ {
+			geLogInfo("message %d", i)
+		}
+	}()
+	wg.Wait()
+}
+
+func TestSetLoggerConfigKeepsCustomLogger(t *testing.T) {
+	t.Cleanup(func() {
+		SetLoggerConfig(LoggerConfig{Type: LoggerTypeOff})
+		logInstance.Store(globalLogger{})
+		currentLogLevel.Store(0)
+	})
+
+	SetLoggerConfig(LoggerConfig{Type: LoggerTypeWriteFile, Path: filepath.Join(t.TempDir(), "ge.log")})
+	logger := &bufferLogger{}
+	SetCustomLogger(logger)
+	SetLoggerConfig(LoggerConfig{Type: LoggerTypePrint})
+	geLogInfo("kept")
+	if globalCustomLogger() != logger || logger.String() == "" {
+		t.Fatal("the logger set by SetCustomLogger is replaced")
+	}
+}
@@ -1,7 +1,9 @@
 package gedata
 
 import (
-	"errors"
+	"context"
+	"fmt"
+	"sync"
 	"time"
 )
 
@@ -51,135 +53,750 @@ type GEConsumer interface {
 	IsStringent() bool // check data or not.
 }
 
+// GEContextConsumer is implemented by consumers which support cancellation and deadlines.
+// Consumers that only implement GEConsumer are wrapped by an adapter which checks the context
+// before every call.
+type GEContextConsumer interface {
+	GEConsumer
+	AddCtx(ctx context.Context, d Data) error
+	FlushCtx(ctx context.Context) error
+	CloseCtx(ctx context.Context) error
+}
+
+// GEAnalytics is returned by value, its copies share the configuration and state, so that a setter called
+// on any copy affects all of them.
 type GEAnalytics struct {
-	consumer GEConsumer
+	consumer   GEContextConsumer
+	hooks      *geHooks
+	state      *geState
+	log        *instanceLogger // nil means the global logger
+	clock      func() time.Time
+	validation ValidationMode
+	*geConfig
 }
 
-// New init SDK
-func New(c GEConsumer) GEAnalytics {
-	geLogInfo("init SDK success")
+// geConfig is the configuration which can be changed after New, it is guarded by mutex.
+type geConfig struct {
+	mutex           *sync.RWMutex
+	superProperties map[string]interface{} // common properties of every event
+	dynamicSuper    func() map[string]interface{}
+	dateFormat      string // layout of time.Time properties
+	interceptors    []Interceptor
+	redactor        *redactor
+	schemaRegistry  *SchemaRegistry
+
+	sampleRates       map[string]float64 // sample rate by event name
+	defaultSampleRate float64
+}
+
+// New init SDK. Options only affect the returned instance, without log options it shares the logger of
+// the consumer, otherwise its logger is also used by the consumer.
+func New(c GEConsumer, opts ...Option) GEAnalytics {
+	o := options{clock: time.Now}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(&o)
+		}
+	}
+	if o.superProperties == nil {
+		o.superProperties = make(map[string]interface{})
+	}
+	if o.clock == nil {
+		o.clock = time.Now
+	}
+
+	var log *instanceLogger
+	if o.logger != nil || o.leveled != nil || o.logLevel != 0 {
+		log = &instanceLogger{level: o.logLevel, logger: o.logger, leveled: o.leveled}
+		setLogger(c, log)
+	} else {
+		log = consumerLogger(c)
+	}
+	log.info("init SDK success")
+
+	hooks := &geHooks{log: log}
+	setDropHandler(c, hooks.notifyDrop)
 	return GEAnalytics{
-		consumer: c,
+		hooks:      hooks,
+		state:      newGEState(),
+		consumer:   toContextConsumer(c),
+		log:        log,
+		clock:      o.clock,
+		validation: o.validation,
+		geConfig: &geConfig{
+			mutex:             new(sync.RWMutex),
+			superProperties:   o.superProperties,
+			dateFormat:        DATE_FORMAT,
+			interceptors:      o.interceptors,
+			defaultSampleRate: 1,
+		},
 	}
 }
 
-// Track report ordinary event
+// SetDateFormat set the layout used to format time.Time properties, default is DATE_FORMAT.
+func (ge *GEAnalytics) SetDateFormat(layout string) {
+	if layout == "" {
+		return
+	}
+	ge.mutex.Lock()
+	defer ge.mutex.Unlock()
+	ge.dateFormat = layout
+}
+
+// SetSuperProperties set common properties for every event, properties passed to Track take precedence.
+func (ge *GEAnalytics) SetSuperProperties(superProperties map[string]interface{}) {
+	ge.mutex.Lock()
+	defer ge.mutex.Unlock()
+	for k, v := range superProperties {
+		ge.superProperties[k] = deepCopyValue(v)
+	}
+}
+
+// UnsetSuperProperty remove the common property of key.
+func (ge *GEAnalytics) UnsetSuperProperty(key string) {
+	ge.mutex.Lock()
+	defer ge.mutex.Unlock()
+	delete(ge.superProperties, key)
+}
+
+// ClearSuperProperties remove all common properties.
+func (ge *GEAnalytics) ClearSuperProperties() {
+	ge.mutex.Lock()
+	defer ge.mutex.Unlock()
+	clear(ge.superProperties)
+}
+
+// SetDynamicSuperProperties set a callback which is evaluated on every Track, its properties override
+// the static super properties and are overridden by the properties passed to Track. Pass nil to remove it.
+func (ge *GEAnalytics) SetDynamicSuperProperties(action func() map[string]interface{}) {
+	ge.mutex.Lock()
+	defer ge.mutex.Unlock()
+	ge.dynamicSuper = action
+}
+
+// GetSuperProperties return a copy of the common properties.
+func (ge *GEAnalytics) GetSuperProperties() map[string]interface{} {
+	ge.mutex.RLock()
+	defer ge.mutex.RUnlock()
+	result := make(map[string]interface{}, len(ge.superProperties))
+	copyProperties(result, ge.superProperties)
+	return result
+}
+
+// Track report ordinary event. The properties, including nested maps and slices, are copied before
+// Track returns, so the caller may change or reuse them afterwards.
 func (ge *GEAnalytics) Track(clientId, eventName string, properties map[string]interface{}) error {
-	return ge.track(clientId, eventName, properties)
+	return ge.TrackCtx(context.Background(), clientId, eventName, properties)
+}
+
+// TrackCtx report ordinary event, the ctx bounds the time spent inside the consumer.
+func (ge *GEAnalytics) TrackCtx(ctx context.Context, clientId, eventName string, properties map[string]interface{}) error {
+	return ge.track(ctx, clientId, eventName, time.Time{}, properties)
+}
+
+// TrackWithTime report an event which happened at eventTime, the event would be marked as time_free.
+// The time can also be passed by the reserved property "#time" as time.Time or string.
+func (ge *GEAnalytics) TrackWithTime(clientId, eventName string, eventTime time.Time, properties map[string]interface{}) error {
+	return ge.TrackWithTimeCtx(context.Background(), clientId, eventName, eventTime, properties)
 }
 
-func (ge *GEAnalytics) track(clientId, eventName string, properties map[string]interface{}) error {
+// TrackWithTimeCtx is the same as TrackWithTime, but accepts a context.
+func (ge *GEAnalytics) TrackWithTimeCtx(ctx context.Context, clientId, eventName string, eventTime time.Time, properties map[string]interface{}) error {
+	return ge.track(ctx, clientId, eventName, eventTime, properties)
+}
+
+func (ge *GEAnalytics) track(ctx context.Context, clientId, eventName string, eventTime time.Time, properties map[string]interface{}) (err error) {
 	defer func() {
-		if r := recover(); r != nil {
-			geLogError("%+v\nData: %+v", r, properties)
-		}
+		ge.afterCall(recover(), &err, func() Data {
+			return ge.stubData(clientId, EventListItem{Type: Track, EventName: eventName, Properties: properties})
+		})
 	}()
 
+	var leave func()
+	if ctx, leave, err = ge.enter(ctx, clientId); err != nil {
+		return err
+	}
+	defer leave()
+
+	item, keep, err := ge.trackItem(ctx, clientId, eventName, eventTime, properties)
+	if err != nil || !keep {
+		return err
+	}
+	return ge.add(ctx, clientId, []EventListItem{item})
+}
+
+// trackItem build the item of an ordinary event, it returns false if the event is dropped.
+func (ge *GEAnalytics) trackItem(ctx context.Context, clientId, eventName string, eventTime time.Time, properties map[string]interface{}) (EventListItem, bool, error) {
 	if len(eventName) == 0 {
-		msg := "the event name must be provided"
-		geLogError(msg)
-		return errors.New(msg)
+		ge.clientLog(clientId).error(ErrEmptyEventName.Error())
+		return EventListItem{}, false, ErrEmptyEventName
+	}
+
+	ge.mutex.RLock()
+	schemaRegistry := ge.schemaRegistry
+	ge.mutex.RUnlock()
+	properties, keep, err := schemaRegistry.apply(ge.log, eventName, properties)
+	if err != nil || !keep {
+		return EventListItem{}, false, err
+	}
+
+	rate, sampled := ge.sampleRate(clientId, eventName)
+	if !sampled {
+		ge.log.debug("event %s of %s is not sampled, rate: %v", eventName, clientId, rate)
+		return EventListItem{}, false, nil
 	}
 
 	p := map[string]interface{}{}
 
 	p["$lib"] = LibName
 	p["$lib_version"] = SdkVersion
-	mergeProperties(p, properties)
+	ge.mutex.RLock()
+	copyProperties(p, ge.superProperties)
+	dynamicSuper := ge.dynamicSuper
+	ge.mutex.RUnlock()
+	// interceptors and the extraction of "#time" work on a copy owned by the SDK
+	copyProperties(p, ge.evalDynamicSuperProperties(ctx, clientId, eventName, properties, dynamicSuper))
+	copyProperties(p, properties)
+	if rate < 1 {
+		p[SampleRateProperty] = rate
+	}
+
+	return ge.newItem(clientId, Track, eventName, eventTime, p)
+}
+
+// TrackStruct report ordinary event, the properties are encoded from a struct by `ge:"name,omitempty"` tags.
+func (ge *GEAnalytics) TrackStruct(clientId, eventName string, properties interface{}) error {
+	return ge.TrackStructCtx(context.Background(), clientId, eventName, properties)
+}
 
-	return ge.add(clientId, Track, eventName, p)
+// TrackStructCtx is the same as TrackStruct, but accepts a context.
+func (ge *GEAnalytics) TrackStructCtx(ctx context.Context, clientId, eventName string, properties interface{}) error {
+	p, err := structToProperties(properties)
+	if err != nil {
+		ge.clientLog(clientId).error(err.Error())
+		ge.hooks.notifyError(ge.stubData(clientId, EventListItem{Type: Track, EventName: eventName}), err)
+		return err
+	}
+	return ge.track(ctx, clientId, eventName, time.Time{}, p)
+}
+
+// TrackItem is an ordinary event passed to TrackMany.
+type TrackItem struct {
+	EventName  string
+	Time       time.Time // optional, the event would be marked as time_free if it is set
+	Properties map[string]interface{}
+}
+
+// ProfileItem is a profile operation passed to UserMany.
+type ProfileItem struct {
+	Operation  string    // one of UserSet, UserSetOnce, UserUnset, UserIncrement, UserNumMax, UserNumMin, UserAppend, UserUniqAppend, UserDel
+	Time       time.Time // optional, the operation would be marked as time_free if it is set
+	Properties map[string]interface{}
+}
+
+// TrackMany report several events of one client as one Data. If any event is invalid, nothing is reported.
+// The batch consumer splits Data with more events than BatchSize, its parts may be dropped separately.
+func (ge *GEAnalytics) TrackMany(clientId string, items []TrackItem) error {
+	return ge.TrackManyCtx(context.Background(), clientId, items)
+}
+
+// TrackManyCtx is the same as TrackMany, but accepts a context.
+func (ge *GEAnalytics) TrackManyCtx(ctx context.Context, clientId string, items []TrackItem) (err error) {
+	defer func() {
+		ge.afterCall(recover(), &err, func() Data {
+			list := make([]EventListItem, 0, len(items))
+			for _, t := range items {
+				list = append(list, EventListItem{Type: Track, EventName: t.EventName, Properties: t.Properties})
+			}
+			return ge.stubData(clientId, list...)
+		})
+	}()
+
+	var leave func()
+	if ctx, leave, err = ge.enter(ctx, clientId); err != nil {
+		return err
+	}
+	defer leave()
+
+	list := make([]EventListItem, 0, len(items))
+	for _, t := range items {
+		item, keep, err := ge.trackItem(ctx, clientId, t.EventName, t.Time, t.Properties)
+		if err != nil {
+			return err
+		}
+		if keep {
+			list = append(list, item)
+		}
+	}
+	return ge.add(ctx, clientId, list)
+}
+
+// UserMany apply several profile operations of one client as one Data, in the given order.
+// If any operation is invalid, nothing is reported.
+func (ge *GEAnalytics) UserMany(clientId string, items []ProfileItem) error {
+	return ge.UserManyCtx(context.Background(), clientId, items)
+}
+
+// UserManyCtx is the same as UserMany, but accepts a context.
+func (ge *GEAnalytics) UserManyCtx(ctx context.Context, clientId string, items []ProfileItem) (err error) {
+	defer func() {
+		ge.afterCall(recover(), &err, func() Data {
+			list := make([]EventListItem, 0, len(items))
+			for _, u := range items {
+				list = append(list, EventListItem{Type: Profile, EventName: u.Operation, Properties: u.Properties})
+			}
+			return ge.stubData(clientId, list...)
+		})
+	}()
+
+	var leave func()
+	if ctx, leave, err = ge.enter(ctx, clientId); err != nil {
+		return err
+	}
+	defer leave()
+
+	list := make([]EventListItem, 0, len(items))
+	for _, u := range items {
+		item, keep, err := ge.userItem(clientId, u.Operation, u.Time, u.Properties)
+		if err != nil {
+			return err
+		}
+		if keep {
+			list = append(list, item)
+		}
+	}
+	return ge.add(ctx, clientId, list)
+}
+
+// evalDynamicSuperProperties run the callback. A panic inside it is logged and passed to the error
+// handler as ErrPanicRecovered, the event is still reported without the dynamic super properties.
+func (ge *GEAnalytics) evalDynamicSuperProperties(ctx context.Context, clientId, eventName string, properties map[string]interface{}, action func() map[string]interface{}) (result map[string]interface{}) {
+	if action == nil {
+		return nil
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			err := fmt.Errorf("%w: dynamic super properties: %v", ErrPanicRecovered, r)
+			ge.clientLog(clientId).error(err.Error())
+			d := ge.stubData(clientId, EventListItem{Type: Track, EventName: eventName, Properties: properties})
+			deferHook(ctx, func() { ge.hooks.notifyError(d, err) })
+			result = nil
+		}
+	}()
+	return action()
 }
 
 // UserSet set user properties. would overwrite existing names.
 func (ge *GEAnalytics) UserSet(clientId string, properties map[string]interface{}) error {
-	return ge.user(clientId, UserSet, properties)
+	return ge.UserSetCtx(context.Background(), clientId, properties)
+}
+
+// UserSetCtx is the same as UserSet, but accepts a context.
+func (ge *GEAnalytics) UserSetCtx(ctx context.Context, clientId string, properties map[string]interface{}) error {
+	return ge.user(ctx, clientId, UserSet, time.Time{}, properties)
+}
+
+// UserSetWithTime set user properties at eventTime, the data would be marked as time_free.
+func (ge *GEAnalytics) UserSetWithTime(clientId string, eventTime time.Time, properties map[string]interface{}) error {
+	return ge.UserSetWithTimeCtx(context.Background(), clientId, eventTime, properties)
+}
+
+// UserSetWithTimeCtx is the same as UserSetWithTime, but accepts a context.
+func (ge *GEAnalytics) UserSetWithTimeCtx(ctx context.Context, clientId string, eventTime time.Time, properties map[string]interface{}) error {
+	return ge.user(ctx, clientId, UserSet, eventTime, properties)
+}
+
+// UserSetStruct set user properties encoded from a struct by `ge:"name,omitempty"` tags.
+func (ge *GEAnalytics) UserSetStruct(clientId string, properties interface{}) error {
+	return ge.UserSetStructCtx(context.Background(), clientId, properties)
+}
+
+// UserSetStructCtx is the same as UserSetStruct, but accepts a context.
+func (ge *GEAnalytics) UserSetStructCtx(ctx context.Context, clientId string, properties interface{}) error {
+	p, err := structToProperties(properties)
+	if err != nil {
+		ge.clientLog(clientId).error(err.Error())
+		ge.hooks.notifyError(ge.stubData(clientId, EventListItem{Type: Profile, EventName: UserSet}), err)
+		return err
+	}
+	return ge.user(ctx, clientId, UserSet, time.Time{}, p)
 }
 
 // UserUnset clear the user properties of users.
 func (ge *GEAnalytics) UserUnset(clientId string, properties map[string]interface{}) error {
-	if len(properties) == 0 {
-		msg := "invalid params for UserUnset: properties is nil"
-		geLogInfo(msg)
-		return errors.New(msg)
-	}
-	return ge.user(clientId, UserUnset, properties)
+	return ge.UserUnsetCtx(context.Background(), clientId, properties)
+}
+
+// UserUnsetCtx is the same as UserUnset, but accepts a context.
+func (ge *GEAnalytics) UserUnsetCtx(ctx context.Context, clientId string, properties map[string]interface{}) error {
+	return ge.user(ctx, clientId, UserUnset, time.Time{}, properties)
 }
 
 // UserSetOnce set user properties, If such property had been set before, this message would be neglected.
 func (ge *GEAnalytics) UserSetOnce(clientId string, properties map[string]interface{}) error {
-	return ge.user(clientId, UserSetOnce, properties)
+	return ge.UserSetOnceCtx(context.Background(), clientId, properties)
+}
+
+// UserSetOnceCtx is the same as UserSetOnce, but accepts a context.
+func (ge *GEAnalytics) UserSetOnceCtx(ctx context.Context, clientId string, properties map[string]interface{}) error {
+	return ge.user(ctx, clientId, UserSetOnce, time.Time{}, properties)
 }
 
 // UserIncrement to accumulate operations against the property.
 func (ge *GEAnalytics) UserIncrement(clientId string, properties map[string]interface{}) error {
-	return ge.user(clientId, UserIncrement, properties)
+	return ge.UserIncrementCtx(context.Background(), clientId, properties)
+}
+
+// UserIncrementCtx is the same as UserIncrement, but accepts a context.
+func (ge *GEAnalytics) UserIncrementCtx(ctx context.Context, clientId string, properties map[string]interface{}) error {
+	return ge.user(ctx, clientId, UserIncrement, time.Time{}, properties)
 }
 
 // UserAppend to add user properties of array type.
 func (ge *GEAnalytics) UserAppend(clientId string, properties map[string]interface{}) error {
-	return ge.user(clientId, UserAppend, properties)
+	return ge.UserAppendCtx(context.Background(), clientId, properties)
+}
+
+// UserAppendCtx is the same as UserAppend, but accepts a context.
+func (ge *GEAnalytics) UserAppendCtx(ctx context.Context, clientId string, properties map[string]interface{}) error {
+	return ge.user(ctx, clientId, UserAppend, time.Time{}, properties)
 }
 
 // UserUniqAppend append user properties to array type by unique.
 func (ge *GEAnalytics) UserUniqAppend(clientId string, properties map[string]interface{}) error {
-	return ge.user(clientId, UserUniqAppend, properties)
+	return ge.UserUniqAppendCtx(context.Background(), clientId, properties)
+}
+
+// UserUniqAppendCtx is the same as UserUniqAppend, but accepts a context.
+func (ge *GEAnalytics) UserUniqAppendCtx(ctx context.Context, clientId string, properties map[string]interface{}) error {
+	return ge.user(ctx, clientId, UserUniqAppend, time.Time{}, properties)
 }
 
 // UserDelete delete a user, This operation cannot be undone.
 func (ge *GEAnalytics) UserDelete(clientId string) error {
-	return ge.user(clientId, UserDel, map[string]interface{}{"": ""})
+	return ge.UserDeleteCtx(context.Background(), clientId)
+}
+
+// UserDeleteCtx is the same as UserDelete, but accepts a context.
+func (ge *GEAnalytics) UserDeleteCtx(ctx context.Context, clientId string) error {
+	return ge.user(ctx, clientId, UserDel, time.Time{}, nil)
 }
 
 func (ge *GEAnalytics) UserNumMax(clientId string, properties map[string]interface{}) error {
-	return ge.user(clientId, UserNumMax, properties)
+	return ge.UserNumMaxCtx(context.Background(), clientId, properties)
+}
+
+// UserNumMaxCtx is the same as UserNumMax, but accepts a context.
+func (ge *GEAnalytics) UserNumMaxCtx(ctx context.Context, clientId string, properties map[string]interface{}) error {
+	return ge.user(ctx, clientId, UserNumMax, time.Time{}, properties)
 }
 
 func (ge *GEAnalytics) UserNumMin(clientId string, properties map[string]interface{}) error {
-	return ge.user(clientId, UserNumMin, properties)
+	return ge.UserNumMinCtx(context.Background(), clientId, properties)
+}
+
+// UserNumMinCtx is the same as UserNumMin, but accepts a context.
+func (ge *GEAnalytics) UserNumMinCtx(ctx context.Context, clientId string, properties map[string]interface{}) error {
+	return ge.user(ctx, clientId, UserNumMin, time.Time{}, properties)
 }
 
-func (ge *GEAnalytics) user(clientId, eventName string, properties map[string]interface{}) error {
+func (ge *GEAnalytics) user(ctx context.Context, clientId, eventName string, eventTime time.Time, properties map[string]interface{}) (err error) {
 	defer func() {
-		if r := recover(); r != nil {
-			geLogError("%+v\nData: %+v", r, properties)
-		}
+		ge.afterCall(recover(), &err, func() Data {
+			return ge.stubData(clientId, EventListItem{Type: Profile, EventName: eventName, Properties: properties})
+		})
 	}()
 
+	var leave func()
+	if ctx, leave, err = ge.enter(ctx, clientId); err != nil {
+		return err
+	}
+	defer leave()
+
+	item, keep, err := ge.userItem(clientId, eventName, eventTime, properties)
+	if err != nil || !keep {
+		return err
+	}
+	return ge.add(ctx, clientId, []EventListItem{item})
+}
+
+// userItem build the item of a profile operation, it returns false if the operation is dropped.
+func (ge *GEAnalytics) userItem(clientId, eventName string, eventTime time.Time, properties map[string]interface{}) (EventListItem, bool, error) {
+	switch eventName {
+	case UserSet, UserSetOnce, UserIncrement, UserNumMax, UserNumMin, UserAppend, UserUniqAppend:
+	case UserUnset:
+		if len(properties) == 0 {
+			err := fmt.Errorf("%w: properties of UserUnset must not be empty", ErrInvalidProperty)
+			ge.clientLog(clientId).info(err.Error())
+			return EventListItem{}, false, err
+		}
+	case UserDel:
+		properties = map[string]interface{}{"": ""}
+	default:
+		err := fmt.Errorf("%w: %q", ErrInvalidOperation, eventName)
+		ge.clientLog(clientId).error(err.Error())
+		return EventListItem{}, false, err
+	}
+
 	p := make(map[string]interface{})
-	mergeProperties(p, properties)
-	return ge.add(clientId, Profile, eventName, p)
+	copyProperties(p, properties)
+	return ge.newItem(clientId, Profile, eventName, eventTime, p)
 }
 
 // Flush report data immediately.
 func (ge *GEAnalytics) Flush() error {
-	return ge.consumer.Flush()
+	return ge.FlushCtx(context.Background())
+}
+
+// FlushCtx report data immediately, the ctx bounds the upload. It returns ErrConsumerClosed after Close.
+func (ge *GEAnalytics) FlushCtx(ctx context.Context) error {
+	var err error
+	if ge.state.isClosed() {
+		err = fmt.Errorf("flush failed: %w", ErrConsumerClosed)
+	} else {
+		err = ge.consumer.FlushCtx(ctx)
+	}
+	if err != nil {
+		ge.hooks.notifyError(Data{}, err)
+	}
+	return err
 }
 
 // Close and exit sdk
 func (ge *GEAnalytics) Close() error {
-	err := ge.consumer.Close()
-	geLogInfo("SDK close")
+	return ge.CloseCtx(context.Background())
+}
+
+// CloseCtx close and exit sdk, the ctx bounds the final flush. It waits for the calls of Track and User*
+// in progress, the later calls return ErrConsumerClosed. If ctx is done before they finish, the consumer
+// is left open and the error of ctx is returned. Closing again is allowed, it only retries what the
+// previous Close failed to do.
+func (ge *GEAnalytics) CloseCtx(ctx context.Context) error {
+	first, err := ge.state.close(ctx)
+	if err == nil {
+		err = ge.consumer.CloseCtx(ctx)
+	}
+	if err != nil {
+		ge.hooks.notifyError(Data{}, err)
+	}
+	if first {
+		ge.log.info("SDK close")
+	}
 	return err
 }
 
-func (ge *GEAnalytics) add(clientId, dataType, eventName string, properties map[string]interface{}) error {
+// enter is called at the start of every Track and User* call. If it succeeds, leave must be deferred, it
+// ends the call and then runs the hooks which are deferred by the returned ctx, so that they may call Close.
+func (ge *GEAnalytics) enter(ctx context.Context, clientId string) (context.Context, func(), error) {
+	if !ge.state.enter() {
+		err := fmt.Errorf("add data failed: %w", ErrConsumerClosed)
+		ge.clientLog(clientId).error(err.Error())
+		return ctx, nil, err
+	}
+	ctx, deferred := withDeferredHooks(ctx)
+	return ctx, func() {
+		ge.state.exit()
+		deferred.run()
+	}, nil
+}
+
+// geState is shared by the copies of GEAnalytics. It counts the calls in progress instead of holding a
+// read lock, so that a call made by a hook while Close is waiting fails instead of dead locking. Hooks
+// are run after the call has left, since Close may not return until then.
+type geState struct {
+	mutex    *sync.Mutex
+	closed   bool
+	inflight int
+	idle     chan struct{} // closed once no call is in progress after close
+}
+
+func newGEState() *geState {
+	return &geState{mutex: new(sync.Mutex), idle: make(chan struct{})}
+}
+
+func (s *geState) enter() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.closed {
+		return false
+	}
+	s.inflight++
+	return true
+}
+
+func (s *geState) exit() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.inflight--
+	s.checkIdle()
+}
+
+// close mark the state as closed and wait for the calls in progress until ctx is done, it returns false
+// if already closed.
+func (s *geState) close(ctx context.Context) (bool, error) {
+	s.mutex.Lock()
+	first := !s.closed
+	s.closed = true
+	s.checkIdle()
+	s.mutex.Unlock()
+	if err := ctx.Err(); err != nil {
+		return first, err
+	}
+	select {
+	case <-s.idle:
+		return first, nil
+	case <-ctx.Done():
+		return first, ctx.Err()
+	}
+}
+
+// checkIdle close idle if it is closed and no call is in progress, the mutex must be held.
+func (s *geState) checkIdle() {
+	if !s.closed || s.inflight > 0 {
+		return
+	}
+	select {
+	case <-s.idle:
+	default:
+		close(s.idle)
+	}
+}
+
+func (s *geState) isClosed() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.closed
+}
+
+// newItem build and prepare an item, properties must be owned by the SDK.
+func (ge *GEAnalytics) newItem(clientId, dataType, eventName string, eventTime time.Time, properties map[string]interface{}) (EventListItem, bool, error) {
+	// time passed by the caller, either as argument or as "#time" property, is not checked by receiver.
+	timeFree := !eventTime.IsZero()
+	propertyTime, ok, err := extractTime(properties)
+	if err != nil {
+		ge.clientLog(clientId).error(err.Error())
+		return EventListItem{}, false, err
+	}
+	if ok && !timeFree {
+		eventTime = propertyTime
+		timeFree = true
+	}
+	if eventTime.IsZero() {
+		eventTime = ge.clock()
+	}
+
 	item := EventListItem{
+		TimeFree:   timeFree,
 		Type:       dataType,
 		EventName:  eventName,
-		Time:       time.Now().UnixMilli(),
+		Time:       eventTime.UnixMilli(),
 		Properties: properties,
 	}
+	keep, err := ge.prepareItem(clientId, &item)
+	if err != nil || !keep {
+		return EventListItem{}, false, err
+	}
+	return item, true, nil
+}
+
+// clientLog return the logger with the client id field, it allocates so it is only used on error paths.
+func (ge *GEAnalytics) clientLog(clientId string) *instanceLogger {
+	return ge.log.with(LogField{Key: LogFieldClientId, Value: clientId})
+}
+
+// add send items of one client to the consumer as one Data.
+func (ge *GEAnalytics) add(ctx context.Context, clientId string, items []EventListItem) error {
+	if len(items) == 0 {
+		return nil
+	}
 	data := Data{
 		ClientId:  clientId,
-		EventList: []EventListItem{item},
+		EventList: items,
 	}
 
-	//err := formatProperties(&data, ge)
-	//if err != nil {
-	//	return err
-	//}
+	return ge.consumer.AddCtx(ctx, data)
+}
+
+// prepareItem run interceptors, then check and normalize the properties of item.
+// It returns false if the item is dropped by an interceptor.
+func (ge *GEAnalytics) prepareItem(clientId string, item *EventListItem) (bool, error) {
+	ge.mutex.RLock()
+	interceptors := ge.interceptors
+	dateFormat := ge.dateFormat
+	redactor := ge.redactor
+	ge.mutex.RUnlock()
+
+	if keep, err := runInterceptors(ge.log, interceptors, item, clientId); err != nil || !keep {
+		return keep, err
+	}
+	if item.Properties == nil {
+		item.Properties = make(map[string]interface{})
+	}
 
-	return ge.consumer.Add(data)
+	// stringent validation rejects invalid data, the others only print a warning.
+	stringent := ge.validation.stringent(ge.consumer)
+	if ge.validation == ValidationOff {
+		// properties are not checked
+	} else if err := checkProperties(item.Type, item.EventName, item.Properties); err != nil {
+		if stringent {
+			ge.clientLog(clientId).error(err.Error())
+			return false, err
+		}
+		ge.clientLog(clientId).warning(err.Error())
+	}
+
+	if err := normalizeProperties(item.Properties, dateFormat); err != nil {
+		if stringent {
+			ge.clientLog(clientId).error(err.Error())
+			return false, err
+		}
+		ge.clientLog(clientId).warning("%v, these properties are removed", err)
+	}
+
+	redactor.redact(item.Properties)
+	return true, nil
+}
+
+// propertiesForLog return properties redacted by the redaction policy.
+func (ge *GEAnalytics) propertiesForLog(properties map[string]interface{}) map[string]interface{} {
+	ge.mutex.RLock()
+	redactor := ge.redactor
+	ge.mutex.RUnlock()
+	return redactor.redactCopy(properties)
+}
+
+// contextConsumerAdapter lets a GEConsumer without context support be used as GEContextConsumer.
+// The context is only checked before the call, the underlying operation can not be interrupted.
+type contextConsumerAdapter struct {
+	GEConsumer
+}
+
+func (a contextConsumerAdapter) AddCtx(ctx context.Context, d Data) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return a.Add(d)
+}
+
+func (a contextConsumerAdapter) FlushCtx(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return a.Flush()
+}
+
+func (a contextConsumerAdapter) CloseCtx(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return a.Close()
+}
+
+func toContextConsumer(c GEConsumer) GEContextConsumer {
+	if cc, ok := c.(GEContextConsumer); ok {
+		return cc
+	}
+	return contextConsumerAdapter{c}
 }
 
 // Deprecated: please use GEConsumer
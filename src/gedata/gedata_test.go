@@ -0,0 +1,401 @@
+package gedata
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newTestServer return a receiver which accepts everything.
+func newTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+		_, _ = w.Write([]byte(`{"code":0,"msg":"ok"}`))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func newTestBatchConsumer(t *testing.T, config GEBatchConfig) GEConsumer {
+	t.Helper()
+	if config.ServerUrl == "" {
+		config.ServerUrl = newTestServer(t).URL
+	}
+	c, err := NewBatchConsumerWithConfig(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// recordConsumer keep the data added to it.
+type recordConsumer struct {
+	mutex     sync.Mutex
+	data      []Data
+	stringent bool
+}
+
+func (c *recordConsumer) Add(d Data) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.data = append(c.data, d)
+	return nil
+}
+
+func (c *recordConsumer) Flush() error      { return nil }
+func (c *recordConsumer) Close() error      { return nil }
+func (c *recordConsumer) IsStringent() bool { return c.stringent }
+
+func (c *recordConsumer) items() []EventListItem {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	var items []EventListItem
+	for _, d := range c.data {
+		items = append(items, d.EventList...)
+	}
+	return items
+}
+
+// The caller may change nested maps and slices after Track returns, while the consumer flushes.
+// Run with -race.
+func TestTrackCopiesNestedProperties(t *testing.T) {
+	c := newTestBatchConsumer(t, GEBatchConfig{BatchSize: 5, Compress: false})
+	ge := New(c, WithLogLevel(GELogLevelOff))
+	ge.SetSuperProperties(map[string]interface{}{"cfg": map[string]interface{}{"k": 1}})
+
+	stop := make(chan struct{})
+	flushed := make(chan struct{})
+	go func() {
+		defer close(flushed)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				_ = ge.Flush()
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			nested := map[string]interface{}{"k": 0}
+			list := []interface{}{"a", map[string]interface{}{"k": 0}}
+			properties := map[string]interface{}{"nested": nested, "list": list}
+			for j := 0; j < 200; j++ {
+				if err := ge.Track("client", "event", properties); err != nil {
+					t.Error(err)
+					return
+				}
+				nested["k"] = j
+				list[0] = j
+				list[1].(map[string]interface{})["k"] = j
+				if cfg, ok := ge.GetSuperProperties()["cfg"].(map[string]interface{}); ok {
+					cfg["k"] = j
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(stop)
+	<-flushed
+	if err := ge.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestInterceptorDoesNotChangeCallerProperties(t *testing.T) {
+	c := newTestBatchConsumer(t, GEBatchConfig{})
+	ge := New(c, WithLogLevel(GELogLevelOff), WithInterceptors(func(item *EventListItem, clientId string) error {
+		item.Properties["nested"].(map[string]interface{})["k"] = "changed"
+		item.Properties["list"].([]interface{})[0] = "changed"
+		return nil
+	}))
+	defer ge.Close()
+
+	nested := map[string]interface{}{"k": "origin"}
+	list := []interface{}{"origin"}
+	if err := ge.Track("client", "event", map[string]interface{}{"nested": nested, "list": list}); err != nil {
+		t.Fatal(err)
+	}
+	if nested["k"] != "origin" || list[0] != "origin" {
+		t.Fatalf("caller properties changed by interceptor: %v %v", nested, list)
+	}
+}
+
+func TestSuperPropertiesSharedByCopies(t *testing.T) {
+	c := &recordConsumer{}
+	ge := New(c, WithLogLevel(GELogLevelOff))
+	ge.SetSuperProperties(map[string]interface{}{"a": 1})
+	cp := ge
+	ge.ClearSuperProperties()
+	if err := cp.Track("client", "event", nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := c.items()[0].Properties["a"]; ok {
+		t.Fatal("the copy of GEAnalytics still has the cleared super properties")
+	}
+	if len(cp.GetSuperProperties()) != 0 {
+		t.Fatalf("super properties of the copy: %v", cp.GetSuperProperties())
+	}
+}
+
+func TestDynamicSuperPropertiesPanicIsNotified(t *testing.T) {
+	c := &recordConsumer{}
+	ge := New(c, WithLogLevel(GELogLevelOff))
+	ge.SetDynamicSuperProperties(func() map[string]interface{} {
+		panic("callback failed")
+	})
+	var notified error
+	ge.OnError(func(d Data, err error) {
+		notified = err
+	})
+
+	if err := ge.Track("client", "event", nil); err != nil {
+		t.Fatal(err)
+	}
+	if !errors.Is(notified, ErrPanicRecovered) || !strings.Contains(notified.Error(), "callback failed") {
+		t.Fatalf("error handler got %v", notified)
+	}
+	if len(c.items()) != 1 {
+		t.Fatal("the event is not reported")
+	}
+}
+
+// waitFor fail the test if call does not return in time.
+func waitFor(t *testing.T, what string, call func()) {
+	t.Helper()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		call()
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatalf("%s does not return", what)
+	}
+}
+
+// blockingLogger blocks the messages of writing data until gate is closed.
+type blockingLogger struct {
+	gate chan struct{}
+}
+
+func (l blockingLogger) Log(level GELogLevel, msg string, fields ...LogField) {
+	if strings.HasPrefix(msg, "write event data") {
+		<-l.gate
+	}
+}
+
+// Hooks called during Track run after it, so that they may close the SDK.
+func TestHookMayCloseDuringTrack(t *testing.T) {
+	t.Run("error handler", func(t *testing.T) {
+		ge := New(&recordConsumer{}, WithLogLevel(GELogLevelOff))
+		ge.SetDynamicSuperProperties(func() map[string]interface{} {
+			panic("callback failed")
+		})
+		var closeErr error
+		ge.OnError(func(d Data, err error) {
+			closeErr = ge.Close()
+		})
+		waitFor(t, "Track", func() {
+			if err := ge.Track("client", "event", nil); err != nil {
+				t.Error(err)
+			}
+		})
+		if closeErr != nil {
+			t.Fatal(closeErr)
+		}
+	})
+
+	t.Run("log consumer drop", func(t *testing.T) {
+		gate := make(chan struct{})
+		c, err := NewLogConsumerWithConfig(GELogConsumerConfig{Directory: t.TempDir(), ChannelSize: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ge := New(c, WithLeveledLogger(blockingLogger{gate: gate}))
+		testCloseByDropHandler(t, ge, gate)
+	})
+
+	t.Run("batch consumer drop", func(t *testing.T) {
+		gate := make(chan struct{})
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = io.Copy(io.Discard, r.Body)
+			<-gate
+			_, _ = w.Write([]byte(`{"code":0,"msg":"ok"}`))
+		}))
+		defer server.Close()
+		c := newTestBatchConsumer(t, GEBatchConfig{ServerUrl: server.URL, BatchSize: 1, QueueSize: 1})
+		testCloseByDropHandler(t, New(c, WithLogLevel(GELogLevelOff)), gate)
+	})
+}
+
+// testCloseByDropHandler track until the consumer is full, the drop handler opens gate and closes ge.
+func testCloseByDropHandler(t *testing.T, ge GEAnalytics, gate chan struct{}) {
+	t.Helper()
+	closed := make(chan error, 1)
+	ge.OnDrop(func(d Data, reason DropReason, err error) {
+		if reason != DropReasonChannelFull {
+			return
+		}
+		close(gate)
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		closed <- ge.CloseCtx(ctx)
+	})
+	waitFor(t, "Track", func() {
+		for i := 0; i < 100; i++ {
+			if err := ge.Track("client", "event", nil); errors.Is(err, ErrChannelFull) {
+				return
+			} else if err != nil {
+				t.Error(err)
+				return
+			}
+			time.Sleep(time.Millisecond)
+		}
+		t.Error("consumer is not full")
+	})
+	select {
+	case err := <-closed:
+		if err != nil {
+			t.Fatal(err)
+		}
+	default:
+		t.Fatal("drop handler is not called after Track")
+	}
+}
+
+func TestCloseCtxHonorsDeadline(t *testing.T) {
+	release := make(chan struct{})
+	entered := make(chan struct{})
+	ge := New(&recordConsumer{}, WithLogLevel(GELogLevelOff), WithInterceptors(func(item *EventListItem, clientId string) error {
+		close(entered)
+		<-release
+		return nil
+	}))
+	go func() { _ = ge.Track("client", "event", nil) }()
+	<-entered
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := ge.CloseCtx(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("CloseCtx with a stuck call: %v", err)
+	}
+	if err := ge.Track("client", "event", nil); !errors.Is(err, ErrConsumerClosed) {
+		t.Fatalf("Track after CloseCtx: %v", err)
+	}
+	close(release)
+	waitFor(t, "Close", func() {
+		if err := ge.Close(); err != nil {
+			t.Error(err)
+		}
+	})
+}
+
+// Setters called on any copy of GEAnalytics affect all of them. Run with -race.
+func TestCopiesShareConfig(t *testing.T) {
+	c := &recordConsumer{}
+	ge := New(c, WithLogLevel(GELogLevelOff))
+	cp := ge
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			copied := ge
+			_ = copied.GetSuperProperties()
+		}
+	}()
+	ge.SetRedactionPolicy(&RedactionPolicy{Rules: []RedactRule{{Keys: []string{"email"}, Action: RedactDrop}}})
+	ge.Use(func(item *EventListItem, clientId string) error {
+		item.Properties["intercepted"] = true
+		return nil
+	})
+	ge.SetDynamicSuperProperties(func() map[string]interface{} {
+		return map[string]interface{}{"dynamic": 1}
+	})
+	if err := ge.SetSampleRate("sampled_out", 0); err != nil {
+		t.Fatal(err)
+	}
+	wg.Wait()
+
+	if err := cp.Track("client", "event", map[string]interface{}{"email": "alice@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := cp.Track("client", "sampled_out", nil); err != nil {
+		t.Fatal(err)
+	}
+	items := c.items()
+	if len(items) != 1 {
+		t.Fatalf("items: %+v", items)
+	}
+	p := items[0].Properties
+	if _, ok := p["email"]; ok || p["intercepted"] != true || p["dynamic"] != 1 {
+		t.Fatalf("the copy does not see the config: %v", p)
+	}
+}
+
+// TrackMany and UserMany report their items as one Data in the given order, sampled out events are
+// skipped, and nothing is reported if any item is invalid.
+func TestManyKeepsOrderAndIsAllOrNothing(t *testing.T) {
+	c := &recordConsumer{}
+	ge := New(c, WithLogLevel(GELogLevelOff))
+	if err := ge.SetSampleRate("sampled_out", 0); err != nil {
+		t.Fatal(err)
+	}
+
+	err := ge.TrackMany("client", []TrackItem{
+		{EventName: "first"},
+		{EventName: "sampled_out"},
+		{EventName: "second"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ge.TrackMany("client", []TrackItem{{EventName: "sampled_out"}}); err != nil {
+		t.Fatal(err)
+	}
+	err = ge.UserMany("client", []ProfileItem{
+		{Operation: UserSet, Properties: map[string]interface{}{"level": 1}},
+		{Operation: UserIncrement, Properties: map[string]interface{}{"coins": 5}},
+		{Operation: UserUnset, Properties: map[string]interface{}{"vip": 0}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.data) != 2 {
+		t.Fatalf("data: %+v", c.data)
+	}
+	var names []string
+	for _, item := range c.items() {
+		names = append(names, item.EventName)
+	}
+	if got := strings.Join(names, ","); got != "first,second,"+UserSet+","+UserIncrement+","+UserUnset {
+		t.Fatalf("items are reported as %s", got)
+	}
+
+	err = ge.TrackMany("client", []TrackItem{{EventName: "valid"}, {EventName: ""}})
+	if !errors.Is(err, ErrEmptyEventName) {
+		t.Fatalf("TrackMany with an invalid event: %v", err)
+	}
+	err = ge.UserMany("client", []ProfileItem{{Operation: UserSet}, {Operation: "user_unknown"}})
+	if !errors.Is(err, ErrInvalidOperation) {
+		t.Fatalf("UserMany with an invalid operation: %v", err)
+	}
+	if len(c.data) != 2 {
+		t.Fatalf("invalid items are partially reported: %+v", c.data[2:])
+	}
+}
@@ -0,0 +1,204 @@
+package gedata
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+type DropReason int32
+
+const (
+	DropReasonChannelFull  DropReason = 1 // queue of GELogConsumer or GEBatchConsumer is full
+	DropReasonCacheEvicted DropReason = 2 // the oldest batch is evicted when cache of GEBatchConsumer is full
+	DropReasonPanic        DropReason = 3 // panic recovered while tracking
+	DropReasonRejected     DropReason = 4 // receiver rejected the data
+	DropReasonInvalid      DropReason = 5 // data can not be encoded
+)
+
+func (r DropReason) String() string {
+	switch r {
+	case DropReasonChannelFull:
+		return "channel full"
+	case DropReasonCacheEvicted:
+		return "cache evicted"
+	case DropReasonPanic:
+		return "panic"
+	case DropReasonRejected:
+		return "rejected"
+	case DropReasonInvalid:
+		return "invalid"
+	default:
+		return "unknown"
+	}
+}
+
+// DropHandler is called when data is lost, err describes the cause.
+type DropHandler func(d Data, reason DropReason, err error)
+
+// ErrorHandler is called when a call of GEAnalytics fails, or the dynamic super properties callback panics
+// while the event is still reported. For Track and User* calls the Data holds the event name and the
+// redacted properties passed by the caller, for Flush and Close it is empty.
+type ErrorHandler func(d Data, err error)
+
+// GEDropNotifier is implemented by consumers which may lose data after Add has returned.
+type GEDropNotifier interface {
+	SetDropHandler(handler DropHandler)
+}
+
+// OnError set the handler called whenever a call of GEAnalytics returns an error.
+func (ge *GEAnalytics) OnError(handler ErrorHandler) {
+	ge.hooks.mutex.Lock()
+	defer ge.hooks.mutex.Unlock()
+	ge.hooks.onError = handler
+}
+
+// OnDrop set the handler called whenever data is lost, either inside GEAnalytics or inside the consumer.
+// Data lost by GEBatchConsumer after Add has returned is notified by a goroutine of the consumer, which
+// may call Flush.
+func (ge *GEAnalytics) OnDrop(handler DropHandler) {
+	ge.hooks.mutex.Lock()
+	defer ge.hooks.mutex.Unlock()
+	ge.hooks.onDrop = handler
+}
+
+// geHooks is shared by the copies of GEAnalytics, since the consumer holds a reference to it.
+type geHooks struct {
+	mutex   sync.RWMutex
+	onError ErrorHandler
+	onDrop  DropHandler
+	log     *instanceLogger
+}
+
+func (h *geHooks) notifyError(d Data, err error) {
+	h.mutex.RLock()
+	handler := h.onError
+	h.mutex.RUnlock()
+	if handler == nil {
+		return
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			h.log.error("error handler panic: %+v", r)
+		}
+	}()
+	handler(d, err)
+}
+
+func (h *geHooks) notifyDrop(d Data, reason DropReason, err error) {
+	h.mutex.RLock()
+	handler := h.onDrop
+	h.mutex.RUnlock()
+	if handler == nil {
+		return
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			h.log.error("drop handler panic: %+v", r)
+		}
+	}()
+	handler(d, reason, err)
+}
+
+// afterCall is deferred by Track and User* calls, it converts a recovered panic into ErrPanicRecovered
+// and notifies the hooks. data is only evaluated if the call failed.
+func (ge *GEAnalytics) afterCall(r interface{}, err *error, data func() Data) {
+	if r == nil && *err == nil {
+		return
+	}
+	d := data()
+	if r != nil {
+		*err = fmt.Errorf("%w: %v", ErrPanicRecovered, r)
+		ge.clientLog(d.ClientId).error("%+v\nData: %+v", r, d)
+		ge.hooks.notifyDrop(d, DropReasonPanic, *err)
+	}
+	ge.hooks.notifyError(d, *err)
+}
+
+// stubData describe the data of a failed call by the items passed by the caller, properties are redacted.
+func (ge *GEAnalytics) stubData(clientId string, items ...EventListItem) Data {
+	for i := range items {
+		items[i].Properties = ge.propertiesForLog(items[i].Properties)
+	}
+	return Data{
+		ClientId:  clientId,
+		EventList: items,
+	}
+}
+
+// setDropHandler install handler to the consumer if it supports GEDropNotifier.
+func setDropHandler(c GEConsumer, handler DropHandler) {
+	if n, ok := unwrapConsumer(c).(GEDropNotifier); ok {
+		n.SetDropHandler(handler)
+	}
+}
+
+// dropNotifier is embedded by consumers to report lost data.
+type dropNotifier struct {
+	handler atomic.Value // DropHandler
+}
+
+// SetDropHandler set the handler called when data is lost after Add has returned.
+func (n *dropNotifier) SetDropHandler(handler DropHandler) {
+	n.handler.Store(handler)
+}
+
+// notifyDrop call the handler, a panic of it is logged by log, which is the logger of the consumer.
+// The call is deferred if ctx belongs to a call of GEAnalytics.
+func (n *dropNotifier) notifyDrop(ctx context.Context, log *instanceLogger, d Data, reason DropReason, err error) {
+	handler, _ := n.handler.Load().(DropHandler)
+	if handler == nil {
+		return
+	}
+	deferHook(ctx, func() {
+		defer func() {
+			if r := recover(); r != nil {
+				log.with(LogField{Key: LogFieldClientId, Value: d.ClientId}).error("drop handler panic: %+v", r)
+			}
+		}()
+		handler(d, reason, err)
+	})
+}
+
+// dropRecord is collected while holding locks, and notified after they are released.
+type dropRecord struct {
+	data   Data
+	reason DropReason
+	err    error
+}
+
+// deferredHooks collects the hooks called during a Track or User* call, they are run once the call has
+// ended, so that a hook may call Flush or Close of the same GEAnalytics.
+type deferredHooks struct {
+	mutex *sync.Mutex
+	calls []func()
+}
+
+type deferredHooksKey struct{}
+
+func withDeferredHooks(ctx context.Context) (context.Context, *deferredHooks) {
+	h := &deferredHooks{mutex: new(sync.Mutex)}
+	return context.WithValue(ctx, deferredHooksKey{}, h), h
+}
+
+// deferHook run call after the call of GEAnalytics which ctx belongs to, or immediately if there is none.
+func deferHook(ctx context.Context, call func()) {
+	if h, ok := ctx.Value(deferredHooksKey{}).(*deferredHooks); ok {
+		h.mutex.Lock()
+		h.calls = append(h.calls, call)
+		h.mutex.Unlock()
+		return
+	}
+	call()
+}
+
+func (h *deferredHooks) run() {
+	h.mutex.Lock()
+	calls := h.calls
+	h.calls = nil
+	h.mutex.Unlock()
+	for _, call := range calls {
+		call()
+	}
+}
@@ -0,0 +1,39 @@
+package gedata
+
+import (
+	"errors"
+)
+
+// Interceptor is called for every event before it is sent to the consumer. It can rewrite the item,
+// return ErrDropEvent to drop it, or return any other error to reject it with an *InterceptorError.
+// The properties, including nested maps and slices, are owned by the SDK and may be changed in place.
+type Interceptor func(item *EventListItem, clientId string) error
+
+// Use register interceptors, they run in registration order.
+func (ge *GEAnalytics) Use(interceptors ...Interceptor) {
+	ge.mutex.Lock()
+	defer ge.mutex.Unlock()
+	list := make([]Interceptor, 0, len(ge.interceptors)+len(interceptors))
+	list = append(list, ge.interceptors...)
+	for _, interceptor := range interceptors {
+		if interceptor != nil {
+			list = append(list, interceptor)
+		}
+	}
+	ge.interceptors = list
+}
+
+func runInterceptors(log *instanceLogger, interceptors []Interceptor, item *EventListItem, clientId string) (bool, error) {
+	for i, interceptor := range interceptors {
+		if err := interceptor(item, clientId); err != nil {
+			if errors.Is(err, ErrDropEvent) {
+				log.debug("event %s dropped by interceptor %d", item.EventName, i)
+				return false, nil
+			}
+			err = &InterceptorError{Index: i, Err: err}
+			log.error(err.Error())
+			return false, err
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,222 @@
+package gedata
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"time"
+	"unicode/utf8"
+)
+
+// normalizeProperties convert every value of properties into the form expected by receiver:
+//
+//   - time.Time is formatted by dateFormat, time.Duration is converted to milliseconds
+//   - pointers are dereferenced, nil pointers become nil
+//   - structs are encoded into maps by `ge` tags, json.Marshaler is marshaled eagerly
+//   - []byte becomes string, or base64 string if it is not valid UTF-8
+//   - unsigned integers larger than math.MaxInt64 become decimal strings
+//   - map keys of other types are formatted by fmt.Sprint
+//   - NaN, Inf, invalid JSON, channels, functions and complex numbers are not supported
+//   - values nested deeper than maxPropertyDepth are not supported, which also rejects cyclic values
+//
+// Maps and slices are always copied, so the caller may change them after Track returns.
+// Properties with unsupported values are removed and reported by the returned error.
+func normalizeProperties(properties map[string]interface{}, dateFormat string) error {
+	var errs []error
+	for k, v := range properties {
+		nv, err := normalizeValue(v, dateFormat, 0)
+		if err != nil {
+			delete(properties, k)
+			errs = append(errs, fmt.Errorf("%w: value of %q: %w", ErrInvalidProperty, k, err))
+			continue
+		}
+		properties[k] = nv
+	}
+	return errors.Join(errs...)
+}
+
+// maxPropertyDepth is the max nesting level of a property value, it stops the recursion on cyclic values.
+const maxPropertyDepth = 32
+
+// errInvalidJSON is returned for json.RawMessage and the output of MarshalJSON which are not valid JSON,
+// they would otherwise fail the encoding of the whole batch.
+var errInvalidJSON = errors.New("value is not valid JSON")
+
+var errTooDeep = fmt.Errorf("value is nested deeper than %d levels, it may be cyclic", maxPropertyDepth)
+
+func normalizeValue(v interface{}, dateFormat string, depth int) (interface{}, error) {
+	if depth > maxPropertyDepth {
+		return nil, errTooDeep
+	}
+	rv := reflect.ValueOf(v)
+	if !rv.IsValid() {
+		return nil, nil
+	}
+	if (rv.Kind() == reflect.Ptr || rv.Kind() == reflect.Map || rv.Kind() == reflect.Slice) && rv.IsNil() {
+		return nil, nil
+	}
+
+	switch x := v.(type) {
+	case string, bool, int, int8, int16, int32, int64, uint8, uint16, uint32:
+		return x, nil
+	case json.RawMessage:
+		if !json.Valid(x) {
+			return nil, errInvalidJSON
+		}
+		return append(json.RawMessage(nil), x...), nil
+	case float32:
+		if err := checkFloat(float64(x)); err != nil {
+			return nil, err
+		}
+		return x, nil
+	case float64:
+		if err := checkFloat(x); err != nil {
+			return nil, err
+		}
+		return x, nil
+	case uint:
+		return normalizeUint(uint64(x)), nil
+	case uint64:
+		return normalizeUint(x), nil
+	case time.Time:
+		return x.Format(dateFormat), nil
+	case time.Duration:
+		return x.Milliseconds(), nil
+	case []byte:
+		if utf8.Valid(x) {
+			return string(x), nil
+		}
+		return base64.StdEncoding.EncodeToString(x), nil
+	case json.Marshaler:
+		b, err := x.MarshalJSON()
+		if err != nil {
+			return nil, err
+		}
+		if !json.Valid(b) {
+			return nil, errInvalidJSON
+		}
+		return json.RawMessage(b), nil
+	}
+
+	switch rv.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		return normalizeValue(rv.Elem().Interface(), dateFormat, depth+1)
+	case reflect.Map:
+		m := make(map[string]interface{}, rv.Len())
+		iter := rv.MapRange()
+		for iter.Next() {
+			var key string
+			if iter.Key().Kind() == reflect.String {
+				key = iter.Key().String()
+			} else {
+				key = fmt.Sprint(iter.Key().Interface())
+			}
+			nv, err := normalizeValue(iter.Value().Interface(), dateFormat, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			m[key] = nv
+		}
+		return m, nil
+	case reflect.Slice, reflect.Array:
+		list := make([]interface{}, rv.Len())
+		for i := range list {
+			nv, err := normalizeValue(rv.Index(i).Interface(), dateFormat, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			list[i] = nv
+		}
+		return list, nil
+	case reflect.Struct:
+		encoded, err := encodeStructValue(rv, depth)
+		if err != nil {
+			return nil, err
+		}
+		return normalizeValue(encoded, dateFormat, depth+1)
+	case reflect.Bool:
+		return rv.Bool(), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int(), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return normalizeUint(rv.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		if err := checkFloat(rv.Float()); err != nil {
+			return nil, err
+		}
+		return rv.Float(), nil
+	case reflect.String:
+		return rv.String(), nil
+	}
+	return nil, fmt.Errorf("unsupported type %T", v)
+}
+
+func checkFloat(f float64) error {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return fmt.Errorf("unsupported float value %v", f)
+	}
+	return nil
+}
+
+func normalizeUint(u uint64) interface{} {
+	if u > math.MaxInt64 {
+		return strconv.FormatUint(u, 10)
+	}
+	return int64(u)
+}
+
+// deepCopyValue copy maps, slices and arrays recursively and keep their types, other values are
+// returned as they are. It is used for values which are kept by the SDK before they are normalized.
+// Values deeper than maxPropertyDepth are not copied, they are rejected by normalizeProperties anyway.
+func deepCopyValue(v interface{}) interface{} {
+	rv := reflect.ValueOf(v)
+	if !rv.IsValid() {
+		return v
+	}
+	return deepCopy(rv, 0).Interface()
+}
+
+func deepCopy(rv reflect.Value, depth int) reflect.Value {
+	if depth > maxPropertyDepth {
+		return rv
+	}
+	switch rv.Kind() {
+	case reflect.Interface:
+		if rv.IsNil() {
+			return rv
+		}
+		c := reflect.New(rv.Type()).Elem()
+		c.Set(deepCopy(rv.Elem(), depth+1))
+		return c
+	case reflect.Map:
+		if rv.IsNil() {
+			return rv
+		}
+		c := reflect.MakeMapWithSize(rv.Type(), rv.Len())
+		iter := rv.MapRange()
+		for iter.Next() {
+			c.SetMapIndex(iter.Key(), deepCopy(iter.Value(), depth+1))
+		}
+		return c
+	case reflect.Slice:
+		if rv.IsNil() {
+			return rv
+		}
+		c := reflect.MakeSlice(rv.Type(), rv.Len(), rv.Len())
+		for i := 0; i < rv.Len(); i++ {
+			c.Index(i).Set(deepCopy(rv.Index(i), depth+1))
+		}
+		return c
+	case reflect.Array:
+		c := reflect.New(rv.Type()).Elem()
+		for i := 0; i < rv.Len(); i++ {
+			c.Index(i).Set(deepCopy(rv.Index(i), depth+1))
+		}
+		return c
+	}
+	return rv
+}
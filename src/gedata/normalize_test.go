@@ -0,0 +1,108 @@
+package gedata
+
+import (
+	"encoding/json"
+	"errors"
+	"sync/atomic"
+	"testing"
+)
+
+type cyclicNode struct {
+	Name string
+	Next *cyclicNode
+}
+
+func TestCyclicPropertiesAreRejected(t *testing.T) {
+	c := newTestBatchConsumer(t, GEBatchConfig{})
+	ge := New(c, WithLogLevel(GELogLevelOff), WithValidationMode(ValidationStrict))
+	defer ge.Close()
+
+	m := map[string]interface{}{"k": 1}
+	m["self"] = m
+	if err := ge.Track("client", "event", map[string]interface{}{"cyclic": m}); !errors.Is(err, ErrInvalidProperty) {
+		t.Fatalf("cyclic map: got %v", err)
+	}
+
+	list := []interface{}{nil}
+	list[0] = list
+	if err := ge.Track("client", "event", map[string]interface{}{"cyclic": list}); !errors.Is(err, ErrInvalidProperty) {
+		t.Fatalf("cyclic slice: got %v", err)
+	}
+
+	node := &cyclicNode{Name: "a"}
+	node.Next = node
+	if err := ge.Track("client", "event", map[string]interface{}{"cyclic": node}); !errors.Is(err, ErrInvalidProperty) {
+		t.Fatalf("cyclic pointer: got %v", err)
+	}
+	if err := ge.TrackStruct("client", "event", node); !errors.Is(err, ErrInvalidProperty) {
+		t.Fatalf("cyclic struct: got %v", err)
+	}
+}
+
+func TestCyclicPropertiesAreRemovedInWarnMode(t *testing.T) {
+	c := &recordConsumer{}
+	ge := New(c, WithLogLevel(GELogLevelOff), WithValidationMode(ValidationWarn))
+
+	m := map[string]interface{}{}
+	m["self"] = m
+	if err := ge.Track("client", "event", map[string]interface{}{"cyclic": m, "ok": 1}); err != nil {
+		t.Fatal(err)
+	}
+	items := c.items()
+	if len(items) != 1 {
+		t.Fatalf("items: %v", items)
+	}
+	if _, ok := items[0].Properties["cyclic"]; ok || items[0].Properties["ok"] != 1 {
+		t.Fatalf("properties: %v", items[0].Properties)
+	}
+}
+
+func TestWarnModeKeepsInvalidKeys(t *testing.T) {
+	c := &recordConsumer{}
+	ge := New(c, WithLogLevel(GELogLevelOff), WithValidationMode(ValidationWarn))
+
+	if err := ge.Track("client", "event", map[string]interface{}{"invalid key": 1, "ch": make(chan int)}); err != nil {
+		t.Fatal(err)
+	}
+	properties := c.items()[0].Properties
+	if properties["invalid key"] != 1 {
+		t.Fatalf("invalid key is removed: %v", properties)
+	}
+	if _, ok := properties["ch"]; ok {
+		t.Fatalf("value which can not be encoded is kept: %v", properties)
+	}
+}
+
+// badMarshaler returns invalid JSON.
+type badMarshaler struct{}
+
+func (badMarshaler) MarshalJSON() ([]byte, error) {
+	return []byte("{bad"), nil
+}
+
+// Invalid JSON is removed from its event, the other events of the client in the batch are still sent.
+func TestInvalidJSONIsRemoved(t *testing.T) {
+	var received atomic.Int64
+	c := newTestBatchConsumer(t, GEBatchConfig{ServerUrl: countingServer(t, 0, &received).URL})
+	ge := New(c, WithLogLevel(GELogLevelOff))
+
+	if err := ge.Track("client", "good", map[string]interface{}{"raw": json.RawMessage(`{"k":1}`)}); err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range []interface{}{json.RawMessage("{bad"), badMarshaler{}, []interface{}{json.RawMessage("{bad")}} {
+		if err := ge.Track("client", "bad", map[string]interface{}{"raw": v, "ok": 1}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ge.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if received.Load() != 4 {
+		t.Fatalf("received %d events, want 4", received.Load())
+	}
+
+	strict := New(&recordConsumer{}, WithLogLevel(GELogLevelOff), WithValidationMode(ValidationStrict))
+	if err := strict.Track("client", "bad", map[string]interface{}{"raw": json.RawMessage("{bad")}); !errors.Is(err, ErrInvalidProperty) {
+		t.Fatalf("invalid JSON in strict mode: %v", err)
+	}
+}
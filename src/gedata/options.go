@@ -0,0 +1,103 @@
+package gedata
+
+import (
+	"time"
+)
+
+// ValidationMode decides what happens to properties which fail the checks of the SDK.
+type ValidationMode int32
+
+const (
+	ValidationByConsumer ValidationMode = 0 // reject if the consumer is stringent, otherwise warn
+	ValidationStrict     ValidationMode = 1 // reject the data
+	ValidationWarn       ValidationMode = 2 // print a warning, invalid keys are still sent, values which can not be encoded are removed
+	ValidationOff        ValidationMode = 3 // skip the checks, values which can not be encoded are still removed
+)
+
+// Option configures the GEAnalytics created by New, it only affects that instance.
+type Option func(o *options)
+
+type options struct {
+	logger          GELogger
+	leveled         GELeveledLogger
+	logLevel        GELogLevel
+	clock           func() time.Time
+	validation      ValidationMode
+	superProperties map[string]interface{}
+	interceptors    []Interceptor
+}
+
+// WithLogger set the logger of the instance and its consumer, instead of the one set by SetCustomLogger.
+func WithLogger(logger GELogger) Option {
+	return func(o *options) {
+		o.logger = logger
+	}
+}
+
+// WithLeveledLogger set the leveled logger of the instance and its consumer, it takes precedence over
+// WithLogger. Every level is passed to it unless WithLogLevel is also set.
+func WithLeveledLogger(logger GELeveledLogger) Option {
+	return func(o *options) {
+		o.leveled = logger
+	}
+}
+
+// WithLogLevel set the log level of the instance and its consumer, instead of the one set by SetLogLevel.
+func WithLogLevel(level GELogLevel) Option {
+	return func(o *options) {
+		if level < GELogLevelOff || level > GELogLevelDebug {
+			geLogError("log level %d is invalid, it is ignored", level)
+			return
+		}
+		o.logLevel = level
+	}
+}
+
+// WithClock set the source of the time of events which have no time set by the caller, default is time.Now.
+func WithClock(clock func() time.Time) Option {
+	return func(o *options) {
+		o.clock = clock
+	}
+}
+
+// WithValidationMode set how invalid properties are handled, default is ValidationByConsumer.
+func WithValidationMode(mode ValidationMode) Option {
+	return func(o *options) {
+		o.validation = mode
+	}
+}
+
+// WithSuperProperties set the initial common properties, the same as calling SetSuperProperties.
+func WithSuperProperties(superProperties map[string]interface{}) Option {
+	return func(o *options) {
+		if o.superProperties == nil {
+			o.superProperties = make(map[string]interface{}, len(superProperties))
+		}
+		for k, v := range superProperties {
+			o.superProperties[k] = deepCopyValue(v)
+		}
+	}
+}
+
+// WithInterceptors register the initial interceptors, the same as calling Use.
+func WithInterceptors(interceptors ...Interceptor) Option {
+	return func(o *options) {
+		for _, interceptor := range interceptors {
+			if interceptor != nil {
+				o.interceptors = append(o.interceptors, interceptor)
+			}
+		}
+	}
+}
+
+// stringent reports whether invalid properties reject the data.
+func (m ValidationMode) stringent(consumer GEConsumer) bool {
+	switch m {
+	case ValidationStrict:
+		return true
+	case ValidationByConsumer:
+		return consumer.IsStringent()
+	default:
+		return false
+	}
+}
@@ -0,0 +1,159 @@
+package gedata
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+)
+
+// preset events of GravityEngine
+const (
+	EventPay      = "$PayEvent"
+	EventAdShow   = "$AdShow"
+	EventAdClick  = "$AdClick"
+	EventRegister = "$Register"
+	EventLogin    = "$Login"
+)
+
+// preset properties of GravityEngine. The keys of EventPay follow payEvent(pay_amount, pay_type, order_id,
+// pay_reason, pay_method) of the GravityEngine client SDKs, where $pay_type is the currency and $pay_method
+// is the pay channel.
+const (
+	PropertyOrderId   = "$order_id"
+	PropertyPayAmount = "$pay_amount"
+	PropertyPayType   = "$pay_type"
+	PropertyPayReason = "$pay_reason"
+	PropertyPayMethod = "$pay_method"
+	PropertyAdUnitId  = "$ad_unit_id"
+	PropertyAdNetwork = "$adn_type"
+	PropertyAdType    = "$ad_type"
+	PropertyAdEcpm    = "$ecpm"
+)
+
+// PayInfo describes a payment reported by TrackPay.
+type PayInfo struct {
+	OrderId  string // unique id of the order
+	Amount   int64  // amount in the minor unit of Currency, e.g. cent
+	Currency string // ISO 4217 code, e.g. CNY, USD, reported as $pay_type
+	Method   string // pay channel, e.g. wechat, alipay, apple, reported as $pay_method
+	Reason   string // optional, e.g. the goods of the order
+}
+
+// AdInfo describes an ad reported by TrackAdShow and TrackAdClick.
+type AdInfo struct {
+	UnitId  string  // id of the ad unit
+	Network string  // ad network, e.g. csj, gdt, ks
+	Type    string  // optional, e.g. reward, banner, interstitial
+	Ecpm    float64 // optional, ecpm in the minor unit of currency
+}
+
+func (p PayInfo) properties() (map[string]interface{}, error) {
+	switch {
+	case p.OrderId == "":
+		return nil, fmt.Errorf("%w: OrderId of pay must not be empty", ErrInvalidProperty)
+	case p.Amount <= 0:
+		return nil, fmt.Errorf("%w: Amount of pay must be positive, got %d", ErrInvalidProperty, p.Amount)
+	case len(p.Currency) != 3:
+		return nil, fmt.Errorf("%w: Currency of pay must be ISO 4217 code, got %q", ErrInvalidProperty, p.Currency)
+	case p.Method == "":
+		return nil, fmt.Errorf("%w: Method of pay must not be empty", ErrInvalidProperty)
+	}
+	result := map[string]interface{}{
+		PropertyOrderId:   p.OrderId,
+		PropertyPayAmount: p.Amount,
+		PropertyPayType:   p.Currency,
+		PropertyPayMethod: p.Method,
+	}
+	if p.Reason != "" {
+		result[PropertyPayReason] = p.Reason
+	}
+	return result, nil
+}
+
+func (a AdInfo) properties() (map[string]interface{}, error) {
+	switch {
+	case a.UnitId == "":
+		return nil, fmt.Errorf("%w: UnitId of ad must not be empty", ErrInvalidProperty)
+	case a.Network == "":
+		return nil, fmt.Errorf("%w: Network of ad must not be empty", ErrInvalidProperty)
+	case a.Ecpm < 0 || math.IsNaN(a.Ecpm) || math.IsInf(a.Ecpm, 0):
+		return nil, fmt.Errorf("%w: Ecpm of ad must be a non-negative number, got %v", ErrInvalidProperty, a.Ecpm)
+	}
+	result := map[string]interface{}{
+		PropertyAdUnitId:  a.UnitId,
+		PropertyAdNetwork: a.Network,
+	}
+	if a.Type != "" {
+		result[PropertyAdType] = a.Type
+	}
+	if a.Ecpm > 0 {
+		result[PropertyAdEcpm] = a.Ecpm
+	}
+	return result, nil
+}
+
+// TrackPay report a payment as EventPay, preset properties override the same keys of properties.
+func (ge *GEAnalytics) TrackPay(clientId string, pay PayInfo, properties map[string]interface{}) error {
+	return ge.TrackPayCtx(context.Background(), clientId, pay, properties)
+}
+
+// TrackPayCtx is the same as TrackPay, but accepts a context.
+func (ge *GEAnalytics) TrackPayCtx(ctx context.Context, clientId string, pay PayInfo, properties map[string]interface{}) error {
+	preset, err := pay.properties()
+	return ge.trackPreset(ctx, clientId, EventPay, preset, err, properties)
+}
+
+// TrackAdShow report an ad impression as EventAdShow.
+func (ge *GEAnalytics) TrackAdShow(clientId string, ad AdInfo, properties map[string]interface{}) error {
+	return ge.TrackAdShowCtx(context.Background(), clientId, ad, properties)
+}
+
+// TrackAdShowCtx is the same as TrackAdShow, but accepts a context.
+func (ge *GEAnalytics) TrackAdShowCtx(ctx context.Context, clientId string, ad AdInfo, properties map[string]interface{}) error {
+	preset, err := ad.properties()
+	return ge.trackPreset(ctx, clientId, EventAdShow, preset, err, properties)
+}
+
+// TrackAdClick report an ad click as EventAdClick.
+func (ge *GEAnalytics) TrackAdClick(clientId string, ad AdInfo, properties map[string]interface{}) error {
+	return ge.TrackAdClickCtx(context.Background(), clientId, ad, properties)
+}
+
+// TrackAdClickCtx is the same as TrackAdClick, but accepts a context.
+func (ge *GEAnalytics) TrackAdClickCtx(ctx context.Context, clientId string, ad AdInfo, properties map[string]interface{}) error {
+	preset, err := ad.properties()
+	return ge.trackPreset(ctx, clientId, EventAdClick, preset, err, properties)
+}
+
+// TrackRegister report the registration of the client as EventRegister.
+func (ge *GEAnalytics) TrackRegister(clientId string, properties map[string]interface{}) error {
+	return ge.TrackRegisterCtx(context.Background(), clientId, properties)
+}
+
+// TrackRegisterCtx is the same as TrackRegister, but accepts a context.
+func (ge *GEAnalytics) TrackRegisterCtx(ctx context.Context, clientId string, properties map[string]interface{}) error {
+	return ge.trackPreset(ctx, clientId, EventRegister, nil, nil, properties)
+}
+
+// TrackLogin report the login of the client as EventLogin.
+func (ge *GEAnalytics) TrackLogin(clientId string, properties map[string]interface{}) error {
+	return ge.TrackLoginCtx(context.Background(), clientId, properties)
+}
+
+// TrackLoginCtx is the same as TrackLogin, but accepts a context.
+func (ge *GEAnalytics) TrackLoginCtx(ctx context.Context, clientId string, properties map[string]interface{}) error {
+	return ge.trackPreset(ctx, clientId, EventLogin, nil, nil, properties)
+}
+
+func (ge *GEAnalytics) trackPreset(ctx context.Context, clientId, eventName string, preset map[string]interface{}, presetErr error, properties map[string]interface{}) error {
+	if presetErr != nil {
+		ge.log.error(presetErr.Error())
+		ge.hooks.notifyError(ge.stubData(clientId, EventListItem{Type: Track, EventName: eventName, Properties: properties}), presetErr)
+		return presetErr
+	}
+	p := make(map[string]interface{}, len(properties)+len(preset))
+	mergeProperties(p, properties)
+	mergeProperties(p, preset)
+	return ge.track(ctx, clientId, eventName, time.Time{}, p)
+}
@@ -0,0 +1,39 @@
+package gedata
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestTrackPayProperties(t *testing.T) {
+	c := &recordConsumer{}
+	ge := New(c, WithLogLevel(GELogLevelOff))
+	pay := PayInfo{OrderId: "order_1", Amount: 600, Currency: "CNY", Method: "wechat", Reason: "gift"}
+	if err := ge.TrackPay("client", pay, map[string]interface{}{PropertyPayType: "overridden"}); err != nil {
+		t.Fatal(err)
+	}
+
+	items := c.items()
+	if len(items) != 1 || items[0].EventName != EventPay {
+		t.Fatalf("unexpected items: %+v", items)
+	}
+	expected := map[string]interface{}{
+		"$order_id":   "order_1",
+		"$pay_amount": int64(600),
+		"$pay_type":   "CNY",
+		"$pay_method": "wechat",
+		"$pay_reason": "gift",
+	}
+	for k, v := range expected {
+		if items[0].Properties[k] != v {
+			t.Errorf("%s = %v, want %v", k, items[0].Properties[k], v)
+		}
+	}
+	if _, ok := items[0].Properties["$pay_currency"]; ok {
+		t.Error("$pay_currency is not a preset property of GravityEngine")
+	}
+
+	if err := ge.TrackPay("client", PayInfo{OrderId: "order_2", Amount: 600, Currency: "CNY"}, nil); !errors.Is(err, ErrInvalidProperty) {
+		t.Fatalf("pay without Method: %v", err)
+	}
+}
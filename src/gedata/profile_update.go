@@ -0,0 +1,141 @@
+package gedata
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// profileOperations is the order in which the operations of ProfileUpdate are submitted.
+var profileOperations = []string{
+	UserSet, UserSetOnce, UserIncrement, UserNumMax, UserNumMin, UserAppend, UserUniqAppend, UserUnset, UserDel,
+}
+
+// ProfileUpdate accumulates profile operations of one client and submits them as one Data.
+// Setting a key twice by the same operation keeps the last value, using a key by two different
+// operations is a conflict which is reported by Submit. It is not safe for concurrent use.
+type ProfileUpdate struct {
+	ge         *GEAnalytics
+	clientId   string
+	eventTime  time.Time
+	operations map[string]map[string]interface{}
+	keys       map[string]string // operation of every key
+	err        error
+}
+
+// ProfileUpdate create a builder of profile operations for clientId.
+func (ge *GEAnalytics) ProfileUpdate(clientId string) *ProfileUpdate {
+	return &ProfileUpdate{
+		ge:         ge,
+		clientId:   clientId,
+		operations: make(map[string]map[string]interface{}),
+		keys:       make(map[string]string),
+	}
+}
+
+// WithTime set the time of the operations, they would be marked as time_free.
+func (u *ProfileUpdate) WithTime(eventTime time.Time) *ProfileUpdate {
+	u.eventTime = eventTime
+	return u
+}
+
+// Set overwrite the property.
+func (u *ProfileUpdate) Set(key string, value interface{}) *ProfileUpdate {
+	return u.add(UserSet, key, value)
+}
+
+// SetOnce set the property if it has not been set before.
+func (u *ProfileUpdate) SetOnce(key string, value interface{}) *ProfileUpdate {
+	return u.add(UserSetOnce, key, value)
+}
+
+// Unset clear the properties.
+func (u *ProfileUpdate) Unset(keys ...string) *ProfileUpdate {
+	for _, key := range keys {
+		u.add(UserUnset, key, "")
+	}
+	return u
+}
+
+// Increment add value to the number property.
+func (u *ProfileUpdate) Increment(key string, value interface{}) *ProfileUpdate {
+	return u.add(UserIncrement, key, value)
+}
+
+// Max set the number property to value if value is greater.
+func (u *ProfileUpdate) Max(key string, value interface{}) *ProfileUpdate {
+	return u.add(UserNumMax, key, value)
+}
+
+// Min set the number property to value if value is less.
+func (u *ProfileUpdate) Min(key string, value interface{}) *ProfileUpdate {
+	return u.add(UserNumMin, key, value)
+}
+
+// Append add values to the array property.
+func (u *ProfileUpdate) Append(key string, values ...interface{}) *ProfileUpdate {
+	return u.add(UserAppend, key, values)
+}
+
+// UniqAppend add values which do not exist to the array property.
+func (u *ProfileUpdate) UniqAppend(key string, values ...interface{}) *ProfileUpdate {
+	return u.add(UserUniqAppend, key, values)
+}
+
+// Delete delete the user, it can not be combined with other operations.
+func (u *ProfileUpdate) Delete() *ProfileUpdate {
+	if u.err == nil && len(u.keys) > 0 {
+		u.err = fmt.Errorf("%w: delete can not be combined with other operations", ErrProfileConflict)
+	}
+	u.operations[UserDel] = nil
+	return u
+}
+
+func (u *ProfileUpdate) add(operation, key string, value interface{}) *ProfileUpdate {
+	if u.err != nil {
+		return u
+	}
+	if _, ok := u.operations[UserDel]; ok {
+		u.err = fmt.Errorf("%w: delete can not be combined with other operations", ErrProfileConflict)
+		return u
+	}
+	if existing, ok := u.keys[key]; ok && existing != operation {
+		u.err = fmt.Errorf("%w: key %q is used by both %s and %s", ErrProfileConflict, key, existing, operation)
+		return u
+	}
+	u.keys[key] = operation
+	properties, ok := u.operations[operation]
+	if !ok {
+		properties = make(map[string]interface{})
+		u.operations[operation] = properties
+	}
+	properties[key] = value
+	return u
+}
+
+// Submit report the operations in a deterministic order, nothing is reported if any of them is invalid.
+func (u *ProfileUpdate) Submit() error {
+	return u.SubmitCtx(context.Background())
+}
+
+// SubmitCtx is the same as Submit, but accepts a context.
+func (u *ProfileUpdate) SubmitCtx(ctx context.Context) error {
+	if u.err != nil {
+		u.ge.log.error(u.err.Error())
+		u.ge.hooks.notifyError(Data{ClientId: u.clientId}, u.err)
+		return u.err
+	}
+	items := make([]ProfileItem, 0, len(u.operations))
+	for _, operation := range profileOperations {
+		properties, ok := u.operations[operation]
+		if !ok {
+			continue
+		}
+		items = append(items, ProfileItem{
+			Operation:  operation,
+			Time:       u.eventTime,
+			Properties: properties,
+		})
+	}
+	return u.ge.UserManyCtx(ctx, u.clientId, items)
+}
@@ -0,0 +1,90 @@
+package gedata
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProfileUpdateSubmitOrder(t *testing.T) {
+	c := &recordConsumer{}
+	ge := New(c, WithLogLevel(GELogLevelOff))
+	eventTime := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	err := ge.ProfileUpdate("client").
+		WithTime(eventTime).
+		Unset("vip").
+		Append("tags", "a", "b").
+		Increment("coins", 5).
+		Set("level", 1).
+		Set("level", 2).
+		SetOnce("first_login", "2024-01-01").
+		Submit()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(c.data) != 1 {
+		t.Fatalf("operations are not submitted as one Data: %+v", c.data)
+	}
+	var operations []string
+	for _, item := range c.items() {
+		operations = append(operations, item.EventName)
+		if item.Time != eventTime.UnixMilli() || !item.TimeFree {
+			t.Errorf("%s: time %d, time_free %v", item.EventName, item.Time, item.TimeFree)
+		}
+	}
+	expected := []string{UserSet, UserSetOnce, UserIncrement, UserAppend, UserUnset}
+	if strings.Join(operations, ",") != strings.Join(expected, ",") {
+		t.Fatalf("operations are submitted as %v, want %v", operations, expected)
+	}
+	if level := c.items()[0].Properties["level"]; level != 2 {
+		t.Fatalf("the last value is not kept: %v", level)
+	}
+}
+
+func TestProfileUpdateConflicts(t *testing.T) {
+	c := &recordConsumer{}
+	ge := New(c, WithLogLevel(GELogLevelOff))
+	var notified error
+	ge.OnError(func(d Data, err error) {
+		notified = err
+	})
+
+	for name, update := range map[string]*ProfileUpdate{
+		"key of two operations": ge.ProfileUpdate("client").Set("coins", 1).Increment("coins", 1),
+		"delete after set":      ge.ProfileUpdate("client").Set("level", 1).Delete(),
+		"set after delete":      ge.ProfileUpdate("client").Delete().Set("level", 1),
+	} {
+		notified = nil
+		if err := update.Submit(); !errors.Is(err, ErrProfileConflict) {
+			t.Errorf("%s: %v", name, err)
+		}
+		if !errors.Is(notified, ErrProfileConflict) {
+			t.Errorf("%s: OnError is notified with %v", name, notified)
+		}
+	}
+	if len(c.data) != 0 {
+		t.Fatalf("conflicting operations are submitted: %+v", c.data)
+	}
+
+	if err := ge.ProfileUpdate("client").Delete().Submit(); err != nil {
+		t.Fatal(err)
+	}
+	if items := c.items(); len(items) != 1 || items[0].EventName != UserDel {
+		t.Fatalf("Delete alone: %+v", items)
+	}
+}
+
+// Nothing is submitted if any operation is rejected.
+func TestProfileUpdateIsAllOrNothing(t *testing.T) {
+	c := &recordConsumer{stringent: true}
+	ge := New(c, WithLogLevel(GELogLevelOff))
+	err := ge.ProfileUpdate("client").Set("level", 1).Increment("coins", "five").Submit()
+	if !errors.Is(err, ErrInvalidProperty) {
+		t.Fatalf("non-numeric Increment: %v", err)
+	}
+	if len(c.data) != 0 {
+		t.Fatalf("a part of the update is submitted: %+v", c.data)
+	}
+}
@@ -0,0 +1,151 @@
+package gedata
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"regexp"
+	"strings"
+)
+
+type RedactAction int32
+
+const (
+	RedactDrop RedactAction = 0 // remove the property
+	RedactMask RedactAction = 1 // replace the value by RedactionPolicy.Mask
+	RedactHash RedactAction = 2 // replace the value by hex SHA-256 of RedactionPolicy.Salt + value
+)
+
+// DefaultRedactMask is used when RedactionPolicy.Mask is empty.
+const DefaultRedactMask = "******"
+
+// RedactRule match property keys either by Keys (case-insensitive) or by Pattern.
+type RedactRule struct {
+	Keys    []string
+	Pattern *regexp.Regexp
+	Action  RedactAction
+}
+
+// RedactionPolicy is applied to the properties of every event, including the nested maps,
+// before they are sent to the consumer, so that neither the receiver nor the SDK log sees the raw values.
+type RedactionPolicy struct {
+	Rules []RedactRule
+	Salt  string
+	Mask  string
+}
+
+type redactor struct {
+	keys  map[string]RedactAction
+	rules []RedactRule
+	salt  string
+	mask  string
+}
+
+// SetRedactionPolicy set the redaction policy, pass nil to disable it.
+func (ge *GEAnalytics) SetRedactionPolicy(policy *RedactionPolicy) {
+	var r *redactor
+	if policy != nil {
+		r = newRedactor(*policy)
+	}
+	ge.mutex.Lock()
+	defer ge.mutex.Unlock()
+	ge.redactor = r
+}
+
+func newRedactor(policy RedactionPolicy) *redactor {
+	r := &redactor{
+		keys: make(map[string]RedactAction),
+		salt: policy.Salt,
+		mask: policy.Mask,
+	}
+	if r.mask == "" {
+		r.mask = DefaultRedactMask
+	}
+	for _, rule := range policy.Rules {
+		for _, key := range rule.Keys {
+			r.keys[strings.ToLower(key)] = rule.Action
+		}
+		if rule.Pattern != nil {
+			r.rules = append(r.rules, rule)
+		}
+	}
+	return r
+}
+
+func (r *redactor) match(key string) (RedactAction, bool) {
+	if action, ok := r.keys[strings.ToLower(key)]; ok {
+		return action, true
+	}
+	for _, rule := range r.rules {
+		if rule.Pattern.MatchString(key) {
+			return rule.Action, true
+		}
+	}
+	return 0, false
+}
+
+// redact apply the policy to properties in place, nested maps and slices are visited recursively.
+func (r *redactor) redact(properties map[string]interface{}) {
+	if r == nil {
+		return
+	}
+	for k, v := range properties {
+		action, ok := r.match(k)
+		if !ok {
+			properties[k] = r.redactNested(v)
+			continue
+		}
+		switch action {
+		case RedactDrop:
+			delete(properties, k)
+		case RedactMask:
+			properties[k] = r.mask
+		case RedactHash:
+			properties[k] = r.hash(v)
+		}
+	}
+}
+
+func (r *redactor) redactNested(v interface{}) interface{} {
+	switch x := v.(type) {
+	case map[string]interface{}:
+		r.redact(x)
+	case []interface{}:
+		for i := range x {
+			x[i] = r.redactNested(x[i])
+		}
+	}
+	return v
+}
+
+func (r *redactor) hash(v interface{}) string {
+	var raw string
+	switch x := v.(type) {
+	case string:
+		raw = x
+	case json.RawMessage:
+		raw = string(x)
+	default:
+		b, _ := json.Marshal(x)
+		raw = string(b)
+	}
+	sum := sha256.Sum256([]byte(r.salt + raw))
+	return hex.EncodeToString(sum[:])
+}
+
+// redactCopy return a redacted deep copy of properties, it is used to log data which has not been prepared.
+func (r *redactor) redactCopy(properties map[string]interface{}) map[string]interface{} {
+	if r == nil {
+		return properties
+	}
+	result := make(map[string]interface{}, len(properties))
+	for k, v := range properties {
+		nv, err := normalizeValue(v, DATE_FORMAT, 0)
+		if err != nil {
+			nv = nil
+		}
+		result[k] = nv
+	}
+	r.redact(result)
+	return result
+}
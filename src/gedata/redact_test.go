@@ -0,0 +1,168 @@
+package gedata
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+)
+
+const testSecret = "alice@example.com"
+
+func testRedactionPolicy() *RedactionPolicy {
+	return &RedactionPolicy{
+		Rules: []RedactRule{
+			{Keys: []string{"email"}, Action: RedactDrop},
+			{Keys: []string{"PHONE"}, Action: RedactMask},
+			{Keys: []string{"id_card"}, Action: RedactHash},
+			{Pattern: regexp.MustCompile(`_token$`), Action: RedactMask},
+		},
+		Salt: "salt",
+	}
+}
+
+func TestRedactionActions(t *testing.T) {
+	c := &recordConsumer{}
+	ge := New(c, WithLogLevel(GELogLevelOff))
+	ge.SetRedactionPolicy(testRedactionPolicy())
+
+	err := ge.Track("client", "login", map[string]interface{}{
+		"email":        testSecret,
+		"Phone":        "13800000000",
+		"id_card":      "123456",
+		"access_token": "token",
+		"kept":         1,
+		"profile": map[string]interface{}{
+			"email":         testSecret,
+			"refresh_token": "token",
+			"contacts":      []interface{}{map[string]interface{}{"phone": "13900000000", "name": "bob"}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sum := sha256.Sum256([]byte("salt" + "123456"))
+	p := c.items()[0].Properties
+	if _, ok := p["email"]; ok {
+		t.Error("email is not dropped")
+	}
+	if p["Phone"] != DefaultRedactMask || p["access_token"] != DefaultRedactMask {
+		t.Errorf("keys are not masked case-insensitively or by pattern: %v, %v", p["Phone"], p["access_token"])
+	}
+	if p["id_card"] != hex.EncodeToString(sum[:]) {
+		t.Errorf("id_card is not hashed with salt: %v", p["id_card"])
+	}
+	if p["kept"] != 1 {
+		t.Errorf("unmatched key is changed: %v", p["kept"])
+	}
+	profile := p["profile"].(map[string]interface{})
+	if _, ok := profile["email"]; ok || profile["refresh_token"] != DefaultRedactMask {
+		t.Errorf("nested map is not redacted: %v", profile)
+	}
+	contact := profile["contacts"].([]interface{})[0].(map[string]interface{})
+	if contact["phone"] != DefaultRedactMask || contact["name"] != "bob" {
+		t.Errorf("map inside slice is not redacted: %v", contact)
+	}
+
+	ge.SetRedactionPolicy(&RedactionPolicy{Rules: []RedactRule{{Keys: []string{"email"}, Action: RedactMask}}, Mask: "x"})
+	if err := ge.Track("client", "login", map[string]interface{}{"email": testSecret}); err != nil {
+		t.Fatal(err)
+	}
+	if p := c.items()[1].Properties; p["email"] != "x" {
+		t.Errorf("custom mask is not used: %v", p["email"])
+	}
+
+	ge.SetRedactionPolicy(nil)
+	if err := ge.Track("client", "login", map[string]interface{}{"email": testSecret}); err != nil {
+		t.Fatal(err)
+	}
+	if p := c.items()[2].Properties; p["email"] != testSecret {
+		t.Errorf("redaction is not disabled: %v", p["email"])
+	}
+}
+
+// The payload logged by consumers is redacted, since the properties are redacted before they are added.
+func TestRedactedPayloadInConsumerLogs(t *testing.T) {
+	url := newTestServer(t).URL
+	for name, newConsumer := range map[string]func() (GEConsumer, error){
+		"debug": func() (GEConsumer, error) { return NewDebugConsumer(url) },
+		"batch": func() (GEConsumer, error) { return NewBatchConsumerWithConfig(GEBatchConfig{ServerUrl: url}) },
+	} {
+		t.Run(name, func(t *testing.T) {
+			c, err := newConsumer()
+			if err != nil {
+				t.Fatal(err)
+			}
+			logger := &bufferLogger{}
+			ge := New(c, WithLogger(logger), WithLogLevel(GELogLevelDebug))
+			ge.SetRedactionPolicy(testRedactionPolicy())
+			err = ge.Track("client", "login", map[string]interface{}{
+				"email":  testSecret,
+				"nested": map[string]interface{}{"email": testSecret},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := ge.Close(); err != nil {
+				t.Fatal(err)
+			}
+			log := logger.String()
+			if !strings.Contains(log, "login") {
+				t.Fatalf("the payload is not logged: %q", log)
+			}
+			if strings.Contains(log, testSecret) {
+				t.Fatalf("the payload is logged without redaction: %q", log)
+			}
+		})
+	}
+}
+
+// The data passed to the hooks and logged for a failed call is redacted.
+func TestRedactedDataOfFailedCall(t *testing.T) {
+	logger := &bufferLogger{}
+	ge := New(&recordConsumer{}, WithLogger(logger), WithLogLevel(GELogLevelDebug))
+	ge.SetRedactionPolicy(testRedactionPolicy())
+	var mutex sync.Mutex
+	var failed []Data
+	ge.OnError(func(d Data, err error) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		failed = append(failed, d)
+	})
+	ge.Use(func(item *EventListItem, clientId string) error {
+		if item.EventName == "panic" {
+			panic("interceptor failed")
+		}
+		return nil
+	})
+
+	properties := map[string]interface{}{"email": testSecret, "nested": map[string]interface{}{"id_card": "123456"}}
+	if err := ge.Track("client", "", properties); !errors.Is(err, ErrEmptyEventName) {
+		t.Fatal(err)
+	}
+	if err := ge.Track("client", "panic", properties); !errors.Is(err, ErrPanicRecovered) {
+		t.Fatal(err)
+	}
+	if properties["email"] != testSecret {
+		t.Fatal("the properties of the caller are changed")
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	if len(failed) != 2 {
+		t.Fatalf("OnError is called %d times", len(failed))
+	}
+	for _, d := range failed {
+		p := d.EventList[0].Properties
+		if _, ok := p["email"]; ok || p["nested"].(map[string]interface{})["id_card"] == "123456" {
+			t.Fatalf("data passed to OnError is not redacted: %v", p)
+		}
+	}
+	if log := logger.String(); strings.Contains(log, testSecret) || strings.Contains(log, "123456") {
+		t.Fatalf("data of the failed call is logged without redaction: %q", log)
+	}
+}
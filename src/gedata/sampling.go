@@ -0,0 +1,81 @@
+package gedata
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+)
+
+// SampleRateProperty records the sample rate applied to a sampled event.
+const SampleRateProperty = "$sample_rate"
+
+// SetSampleRate set the sample rate of eventName in [0, 1]. Sampling is deterministic by clientId,
+// so that a client is consistently reported or not.
+func (ge *GEAnalytics) SetSampleRate(eventName string, rate float64) error {
+	if err := checkSampleRate(rate); err != nil {
+		return err
+	}
+	ge.mutex.Lock()
+	defer ge.mutex.Unlock()
+	rates := make(map[string]float64, len(ge.sampleRates)+1)
+	mergeSampleRates(rates, ge.sampleRates)
+	rates[eventName] = rate
+	ge.sampleRates = rates
+	return nil
+}
+
+// UnsetSampleRate remove the sample rate of eventName, the default sample rate is used instead.
+func (ge *GEAnalytics) UnsetSampleRate(eventName string) {
+	ge.mutex.Lock()
+	defer ge.mutex.Unlock()
+	rates := make(map[string]float64, len(ge.sampleRates))
+	mergeSampleRates(rates, ge.sampleRates)
+	delete(rates, eventName)
+	ge.sampleRates = rates
+}
+
+// SetDefaultSampleRate set the sample rate of events without their own rate, default is 1.
+func (ge *GEAnalytics) SetDefaultSampleRate(rate float64) error {
+	if err := checkSampleRate(rate); err != nil {
+		return err
+	}
+	ge.mutex.Lock()
+	defer ge.mutex.Unlock()
+	ge.defaultSampleRate = rate
+	return nil
+}
+
+// sampleRate return the rate of eventName and whether the client is sampled in.
+func (ge *GEAnalytics) sampleRate(clientId, eventName string) (float64, bool) {
+	ge.mutex.RLock()
+	rate, ok := ge.sampleRates[eventName]
+	if !ok {
+		rate = ge.defaultSampleRate
+	}
+	ge.mutex.RUnlock()
+
+	if rate >= 1 {
+		return rate, true
+	}
+	return rate, sampleBucket(clientId) < rate
+}
+
+// sampleBucket map clientId into [0, 1).
+func sampleBucket(clientId string) float64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(clientId))
+	return float64(h.Sum64()%10000) / 10000
+}
+
+func checkSampleRate(rate float64) error {
+	if math.IsNaN(rate) || rate < 0 || rate > 1 {
+		return fmt.Errorf("%w: sample rate must be in [0, 1], got %v", ErrInvalidConfig, rate)
+	}
+	return nil
+}
+
+func mergeSampleRates(target, source map[string]float64) {
+	for k, v := range source {
+		target[k] = v
+	}
+}
@@ -0,0 +1,19 @@
+package gedata
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestInvalidSampleRate(t *testing.T) {
+	ge := New(&recordConsumer{}, WithLogLevel(GELogLevelOff))
+	for _, rate := range []float64{math.NaN(), -0.1, 1.1, math.Inf(1)} {
+		if err := ge.SetSampleRate("event", rate); !errors.Is(err, ErrInvalidConfig) {
+			t.Errorf("SetSampleRate(%v): %v", rate, err)
+		}
+		if err := ge.SetDefaultSampleRate(rate); !errors.Is(err, ErrInvalidConfig) {
+			t.Errorf("SetDefaultSampleRate(%v): %v", rate, err)
+		}
+	}
+}
@@ -0,0 +1,405 @@
+package gedata
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type PropertyType int32
+
+const (
+	PropertyTypeAny    PropertyType = 0
+	PropertyTypeString PropertyType = 1
+	PropertyTypeNumber PropertyType = 2
+	PropertyTypeBool   PropertyType = 3
+	PropertyTypeTime   PropertyType = 4 // time.Time or string in DATE_FORMAT / RFC3339
+	PropertyTypeList   PropertyType = 5
+	PropertyTypeObject PropertyType = 6 // map or struct
+)
+
+type SchemaMode int32
+
+const (
+	SchemaModeReject SchemaMode = 0 // return an error and do not report the event
+	SchemaModeWarn   SchemaMode = 1 // print a warning and report the event as it is
+	SchemaModeStrip  SchemaMode = 2 // remove invalid properties, drop events which can not be fixed
+)
+
+// PropertySchema describes one property of an event.
+type PropertySchema struct {
+	Type     PropertyType
+	Required bool
+	Enum     []interface{} // allowed values, numbers are compared by value
+	Min      *float64      // min value of number
+	Max      *float64      // max value of number
+}
+
+// EventSchema describes the properties of an event. Only the properties passed to Track are
+// checked, super properties are not. The reserved "#time" property is always allowed.
+type EventSchema struct {
+	Name       string
+	Properties map[string]PropertySchema
+	AllowExtra bool // allow properties which are not declared
+}
+
+// SchemaRegistry holds the schemas of events, it is safe for concurrent use.
+type SchemaRegistry struct {
+	mutex        *sync.RWMutex
+	events       map[string]EventSchema
+	mode         SchemaMode
+	allowUnknown bool
+}
+
+// NewSchemaRegistry create SchemaRegistry
+// mode: how to handle events which violate their schema
+// allowUnknown: allow events which are not registered
+func NewSchemaRegistry(mode SchemaMode, allowUnknown bool) *SchemaRegistry {
+	return &SchemaRegistry{
+		mutex:        new(sync.RWMutex),
+		events:       make(map[string]EventSchema),
+		mode:         mode,
+		allowUnknown: allowUnknown,
+	}
+}
+
+// Register add or replace the schema of an event.
+func (r *SchemaRegistry) Register(schema EventSchema) error {
+	if schema.Name == "" {
+		return fmt.Errorf("%w: %w", ErrInvalidConfig, ErrEmptyEventName)
+	}
+	for key, p := range schema.Properties {
+		if !checkPattern([]byte(key)) {
+			return fmt.Errorf("%w: key %q of event %s must match %s", ErrInvalidConfig, key, schema.Name, KEY_PATTERN)
+		}
+		if p.Min != nil && p.Max != nil && *p.Min > *p.Max {
+			return fmt.Errorf("%w: min of %q is greater than max in event %s", ErrInvalidConfig, key, schema.Name)
+		}
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.events[schema.Name] = schema
+	return nil
+}
+
+// Lookup return the schema of eventName.
+func (r *SchemaRegistry) Lookup(eventName string) (EventSchema, bool) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	schema, ok := r.events[eventName]
+	return schema, ok
+}
+
+// SetSchemaRegistry validate every Track against the registry, pass nil to disable it.
+func (ge *GEAnalytics) SetSchemaRegistry(registry *SchemaRegistry) {
+	ge.mutex.Lock()
+	defer ge.mutex.Unlock()
+	ge.schemaRegistry = registry
+}
+
+// apply check properties of eventName. It returns the properties to report, which are a copy if
+// some of them are stripped, and false if the event should be dropped.
+func (r *SchemaRegistry) apply(log *instanceLogger, eventName string, properties map[string]interface{}) (map[string]interface{}, bool, error) {
+	if r == nil {
+		return properties, true, nil
+	}
+	schema, ok := r.Lookup(eventName)
+	if !ok {
+		if r.allowUnknown {
+			return properties, true, nil
+		}
+		err := fmt.Errorf("%w: event %s is not registered", ErrSchemaViolation, eventName)
+		return r.handle(log, properties, err, nil, true)
+	}
+
+	var errs []error
+	invalidKeys := make(map[string]bool)
+	fatal := false
+	for _, key := range sortedKeys(properties) {
+		p, declared := schema.Properties[key]
+		if !declared {
+			if !schema.AllowExtra && key != timeProperty {
+				errs = append(errs, fmt.Errorf("%w: property %q is not declared in event %s", ErrSchemaViolation, key, eventName))
+				invalidKeys[key] = true
+			}
+			continue
+		}
+		if err := p.check(properties[key]); err != nil {
+			errs = append(errs, fmt.Errorf("%w: property %q of event %s: %w", ErrSchemaViolation, key, eventName, err))
+			invalidKeys[key] = true
+		}
+	}
+	for _, key := range sortedKeys(schema.Properties) {
+		if _, ok := properties[key]; !ok && schema.Properties[key].Required {
+			errs = append(errs, fmt.Errorf("%w: required property %q of event %s is missing", ErrSchemaViolation, key, eventName))
+			fatal = true
+		}
+	}
+	// a required property which is invalid can not be stripped
+	for key := range invalidKeys {
+		if schema.Properties[key].Required {
+			fatal = true
+		}
+	}
+	if len(errs) == 0 {
+		return properties, true, nil
+	}
+	return r.handle(log, properties, errors.Join(errs...), invalidKeys, fatal)
+}
+
+func (r *SchemaRegistry) handle(log *instanceLogger, properties map[string]interface{}, err error, invalidKeys map[string]bool, fatal bool) (map[string]interface{}, bool, error) {
+	switch r.mode {
+	case SchemaModeWarn:
+		log.warning(err.Error())
+		return properties, true, nil
+	case SchemaModeStrip:
+		if fatal {
+			log.warning("%v, the event is dropped", err)
+			return nil, false, nil
+		}
+		log.warning("%v, these properties are removed", err)
+		result := make(map[string]interface{}, len(properties))
+		for k, v := range properties {
+			if !invalidKeys[k] {
+				result[k] = v
+			}
+		}
+		return result, true, nil
+	default:
+		log.error(err.Error())
+		return nil, false, err
+	}
+}
+
+// check the value against the schema. The error never contains the value, since it is logged and
+// returned before the redaction policy applies.
+func (p PropertySchema) check(v interface{}) error {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+	if rv.Kind() == reflect.Ptr {
+		v = nil
+	} else if rv.IsValid() {
+		v = rv.Interface()
+	}
+	if v == nil {
+		if p.Required {
+			return errors.New("must not be null")
+		}
+		return nil
+	}
+	if !p.Type.match(v) {
+		return fmt.Errorf("must be %s, got %T", p.Type, v)
+	}
+	if len(p.Enum) > 0 && !enumContains(p.Enum, v) {
+		return fmt.Errorf("must be one of %v", p.Enum)
+	}
+	if p.Min != nil || p.Max != nil {
+		f, ok := toFloat(v)
+		if !ok {
+			return fmt.Errorf("must be number to check its range, got %T", v)
+		}
+		if p.Min != nil && f < *p.Min {
+			return fmt.Errorf("must not be less than %v", *p.Min)
+		}
+		if p.Max != nil && f > *p.Max {
+			return fmt.Errorf("must not be greater than %v", *p.Max)
+		}
+	}
+	return nil
+}
+
+func (t PropertyType) match(v interface{}) bool {
+	rv := reflect.ValueOf(v)
+	switch t {
+	case PropertyTypeString:
+		return rv.Kind() == reflect.String
+	case PropertyTypeNumber:
+		_, ok := toFloat(rv.Interface())
+		return ok
+	case PropertyTypeBool:
+		return rv.Kind() == reflect.Bool
+	case PropertyTypeTime:
+		if rv.Kind() == reflect.String {
+			_, err := parseTime(rv.String())
+			return err == nil
+		}
+		return rv.Type() == timeType
+	case PropertyTypeList:
+		return rv.Kind() == reflect.Slice || rv.Kind() == reflect.Array
+	case PropertyTypeObject:
+		return rv.Kind() == reflect.Map || (rv.Kind() == reflect.Struct && rv.Type() != timeType)
+	default:
+		return true
+	}
+}
+
+func (t PropertyType) String() string {
+	switch t {
+	case PropertyTypeString:
+		return "string"
+	case PropertyTypeNumber:
+		return "number"
+	case PropertyTypeBool:
+		return "bool"
+	case PropertyTypeTime:
+		return "time"
+	case PropertyTypeList:
+		return "list"
+	case PropertyTypeObject:
+		return "object"
+	default:
+		return "any"
+	}
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	if d, ok := v.(time.Duration); ok {
+		return float64(d.Milliseconds()), true
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(rv.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), true
+	}
+	return 0, false
+}
+
+func enumContains(enum []interface{}, v interface{}) bool {
+	f, isNumber := toFloat(v)
+	for _, e := range enum {
+		if ef, ok := toFloat(e); ok && isNumber {
+			if ef == f {
+				return true
+			}
+			continue
+		}
+		if reflect.DeepEqual(e, v) {
+			return true
+		}
+	}
+	return false
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Event is a typed event whose properties are encoded from T by `ge` tags.
+type Event[T any] struct {
+	Name string
+}
+
+// RegisterEvent register the schema of T as event name. Every field of T is a declared property,
+// fields with omitempty or of pointer, slice, map or interface type are optional, since they may be
+// nil, the others are required.
+func RegisterEvent[T any](registry *SchemaRegistry, name string) (Event[T], error) {
+	var zero T
+	t := reflect.TypeOf(zero)
+	if t == nil || t.Kind() != reflect.Struct {
+		return Event[T]{}, fmt.Errorf("%w: type of event %s must be struct, got %v", ErrInvalidConfig, name, t)
+	}
+	schema := EventSchema{
+		Name:       name,
+		Properties: make(map[string]PropertySchema),
+	}
+	if err := schemaOfStruct(t, schema.Properties, 0); err != nil {
+		return Event[T]{}, err
+	}
+	if err := registry.Register(schema); err != nil {
+		return Event[T]{}, err
+	}
+	return Event[T]{Name: name}, nil
+}
+
+// Track report the event with properties encoded from v.
+func (e Event[T]) Track(ge *GEAnalytics, clientId string, v T) error {
+	return e.TrackCtx(context.Background(), ge, clientId, v)
+}
+
+// TrackCtx is the same as Track, but accepts a context.
+func (e Event[T]) TrackCtx(ctx context.Context, ge *GEAnalytics, clientId string, v T) error {
+	return ge.TrackStructCtx(ctx, clientId, e.Name, v)
+}
+
+func schemaOfStruct(t reflect.Type, properties map[string]PropertySchema, depth int) error {
+	if depth > maxPropertyDepth {
+		return fmt.Errorf("%w: embedded structs of %s are nested deeper than %d levels", ErrInvalidConfig, t, maxPropertyDepth)
+	}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("ge")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		ft := f.Type
+		optional := false
+		switch ft.Kind() {
+		case reflect.Ptr:
+			ft = ft.Elem()
+			optional = true
+		case reflect.Slice, reflect.Map, reflect.Interface:
+			optional = true
+		}
+		if f.Anonymous && name == "" && ft.Kind() == reflect.Struct && !isOpaqueType(ft) {
+			if err := schemaOfStruct(ft, properties, depth+1); err != nil {
+				return err
+			}
+			continue
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		for _, opt := range strings.Split(opts, ",") {
+			optional = optional || opt == "omitempty"
+		}
+		properties[name] = PropertySchema{
+			Type:     propertyTypeOf(ft),
+			Required: !optional,
+		}
+	}
+	return nil
+}
+
+func propertyTypeOf(t reflect.Type) PropertyType {
+	if t == timeType {
+		return PropertyTypeTime
+	}
+	if t == reflect.TypeOf(time.Duration(0)) {
+		return PropertyTypeNumber
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return PropertyTypeString
+	case reflect.Bool:
+		return PropertyTypeBool
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return PropertyTypeNumber
+	case reflect.Slice, reflect.Array:
+		return PropertyTypeList
+	case reflect.Map, reflect.Struct:
+		return PropertyTypeObject
+	}
+	return PropertyTypeAny
+}
@@ -0,0 +1,175 @@
+package gedata
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type bufferLogger struct {
+	mutex sync.Mutex
+	lines []string
+}
+
+func (l *bufferLogger) Print(message string) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.lines = append(l.lines, message)
+}
+
+func (l *bufferLogger) String() string {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return strings.Join(l.lines, "")
+}
+
+func TestSchemaErrorsDoNotContainValues(t *testing.T) {
+	const secret = "alice@example.com"
+	min := 10.0
+	registry := NewSchemaRegistry(SchemaModeReject, true)
+	err := registry.Register(EventSchema{
+		Name: "login",
+		Properties: map[string]PropertySchema{
+			"email": {Type: PropertyTypeString, Enum: []interface{}{"x"}},
+			"score": {Type: PropertyTypeNumber, Min: &min},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	logger := &bufferLogger{}
+	ge := New(&recordConsumer{}, WithLogger(logger), WithLogLevel(GELogLevelDebug))
+	ge.SetSchemaRegistry(registry)
+	ge.SetRedactionPolicy(&RedactionPolicy{Rules: []RedactRule{{Keys: []string{"email", "score"}, Action: RedactHash}}})
+	var hookErr error
+	ge.OnError(func(d Data, err error) {
+		hookErr = err
+	})
+
+	err = ge.Track("client", "login", map[string]interface{}{"email": secret, "score": 1234567})
+	if !errors.Is(err, ErrSchemaViolation) {
+		t.Fatalf("got %v", err)
+	}
+	for _, text := range []string{err.Error(), hookErr.Error(), logger.String()} {
+		if strings.Contains(text, secret) || strings.Contains(text, "1234567") {
+			t.Fatalf("value leaked: %s", text)
+		}
+	}
+}
+
+func testSchemaRegistry(t *testing.T, mode SchemaMode) *SchemaRegistry {
+	t.Helper()
+	min := 1.0
+	registry := NewSchemaRegistry(mode, false)
+	err := registry.Register(EventSchema{
+		Name: "buy",
+		Properties: map[string]PropertySchema{
+			"item":  {Type: PropertyTypeString, Required: true},
+			"count": {Type: PropertyTypeNumber, Min: &min},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return registry
+}
+
+func TestSchemaModes(t *testing.T) {
+	valid := map[string]interface{}{"item": "apple", "count": 2}
+	extra := map[string]interface{}{"item": "apple", "extra": true}
+	outOfRange := map[string]interface{}{"item": "apple", "count": 0}
+	missing := map[string]interface{}{"count": 2}
+
+	type result struct {
+		reported bool   // whether the event is reported
+		removed  string // property removed from the reported event
+		rejected bool   // whether Track returns ErrSchemaViolation
+	}
+	for _, tc := range []struct {
+		mode       SchemaMode
+		event      string
+		properties map[string]interface{}
+		expected   result
+	}{
+		{SchemaModeReject, "buy", valid, result{reported: true}},
+		{SchemaModeReject, "buy", extra, result{rejected: true}},
+		{SchemaModeReject, "buy", outOfRange, result{rejected: true}},
+		{SchemaModeReject, "buy", missing, result{rejected: true}},
+		{SchemaModeReject, "unknown", valid, result{rejected: true}},
+		{SchemaModeWarn, "buy", extra, result{reported: true}},
+		{SchemaModeWarn, "buy", missing, result{reported: true}},
+		{SchemaModeStrip, "buy", extra, result{reported: true, removed: "extra"}},
+		{SchemaModeStrip, "buy", outOfRange, result{reported: true, removed: "count"}},
+		{SchemaModeStrip, "buy", missing, result{}},
+		{SchemaModeStrip, "unknown", valid, result{}},
+	} {
+		c := &recordConsumer{}
+		ge := New(c, WithLogLevel(GELogLevelOff))
+		ge.SetSchemaRegistry(testSchemaRegistry(t, tc.mode))
+		err := ge.Track("client", tc.event, tc.properties)
+		items := c.items()
+		got := result{reported: len(items) == 1, rejected: errors.Is(err, ErrSchemaViolation)}
+		if err != nil && !got.rejected {
+			t.Errorf("mode %d, %s %v: %v", tc.mode, tc.event, tc.properties, err)
+		}
+		if got.reported {
+			for k := range tc.properties {
+				if _, ok := items[0].Properties[k]; !ok {
+					got.removed = k
+				}
+			}
+		}
+		if got != tc.expected {
+			t.Errorf("mode %d, %s %v: got %+v, want %+v", tc.mode, tc.event, tc.properties, got, tc.expected)
+		}
+	}
+}
+
+func TestSchemaAllowsTimeProperty(t *testing.T) {
+	c := &recordConsumer{}
+	ge := New(c, WithLogLevel(GELogLevelOff))
+	ge.SetSchemaRegistry(testSchemaRegistry(t, SchemaModeReject))
+	eventTime := time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC)
+	if err := ge.Track("client", "buy", map[string]interface{}{"item": "apple", "#time": eventTime}); err != nil {
+		t.Fatal(err)
+	}
+	if item := c.items()[0]; item.Time != eventTime.UnixMilli() || !item.TimeFree {
+		t.Fatalf("time of event: %+v", item)
+	}
+}
+
+type purchase struct {
+	Item  string            `ge:"item"`
+	Count int               `ge:"count"`
+	Tags  []string          `ge:"tags"`
+	Extra map[string]string `ge:"extra"`
+	Note  *string           `ge:"note"`
+}
+
+func TestRegisterEventNilFieldsAreOptional(t *testing.T) {
+	c := &recordConsumer{}
+	ge := New(c, WithLogLevel(GELogLevelOff))
+	registry := NewSchemaRegistry(SchemaModeReject, false)
+	ge.SetSchemaRegistry(registry)
+	event, err := RegisterEvent[purchase](registry, "purchase")
+	if err != nil {
+		t.Fatal(err)
+	}
+	schema, _ := registry.Lookup("purchase")
+	if !schema.Properties["item"].Required || schema.Properties["tags"].Required || schema.Properties["extra"].Required {
+		t.Fatalf("schema: %+v", schema.Properties)
+	}
+
+	if err := event.Track(&ge, "client", purchase{Item: "apple"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := event.Track(&ge, "client", purchase{Item: "apple", Tags: []string{"a"}}); err != nil {
+		t.Fatal(err)
+	}
+	if len(c.items()) != 2 {
+		t.Fatalf("items: %+v", c.items())
+	}
+}
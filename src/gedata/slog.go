@@ -0,0 +1,49 @@
+package gedata
+
+import (
+	"context"
+	"log/slog"
+)
+
+type slogLogger struct {
+	logger *slog.Logger
+}
+
+// NewSlogLogger adapt logger to GELeveledLogger, nil means slog.Default(). Levels are filtered by the
+// handler of logger, and fields become attributes.
+func NewSlogLogger(logger *slog.Logger) GELeveledLogger {
+	return slogLogger{logger: logger}
+}
+
+func (s slogLogger) get() *slog.Logger {
+	if s.logger == nil {
+		return slog.Default()
+	}
+	return s.logger
+}
+
+// Enabled implements GELevelEnabler by the handler of logger.
+func (s slogLogger) Enabled(level GELogLevel) bool {
+	return s.get().Enabled(context.Background(), slogLevel(level))
+}
+
+func (s slogLogger) Log(level GELogLevel, msg string, fields ...LogField) {
+	attrs := make([]slog.Attr, 0, len(fields))
+	for _, field := range fields {
+		attrs = append(attrs, slog.Any(field.Key, field.Value))
+	}
+	s.get().LogAttrs(context.Background(), slogLevel(level), msg, attrs...)
+}
+
+func slogLevel(level GELogLevel) slog.Level {
+	switch level {
+	case GELogLevelError:
+		return slog.LevelError
+	case GELogLevelWarning:
+		return slog.LevelWarn
+	case GELogLevelDebug:
+		return slog.LevelDebug
+	default:
+		return slog.LevelInfo
+	}
+}
@@ -0,0 +1,69 @@
+package gedata
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+// formatCounter counts how many times it is formatted.
+type formatCounter struct {
+	count int
+}
+
+func (f *formatCounter) String() string {
+	f.count++
+	return "formatted"
+}
+
+func TestSlogLoggerFiltersBeforeFormatting(t *testing.T) {
+	var buf bytes.Buffer
+	handler := slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelInfo})
+	log := &instanceLogger{leveled: NewSlogLogger(slog.New(handler))}
+
+	counter := &formatCounter{}
+	log.debug("debug %s", counter)
+	if counter.count != 0 || buf.Len() != 0 {
+		t.Fatalf("a disabled level is formatted %d times: %q", counter.count, buf.String())
+	}
+	log.info("info %s", counter)
+	if counter.count != 1 || !strings.Contains(buf.String(), `level=INFO msg="info formatted"`) {
+		t.Fatalf("an enabled level is formatted %d times: %q", counter.count, buf.String())
+	}
+}
+
+func TestSlogLoggerFields(t *testing.T) {
+	var buf bytes.Buffer
+	handler := slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})
+	ge := New(&recordConsumer{}, WithLeveledLogger(NewSlogLogger(slog.New(handler))))
+
+	if err := ge.Track("client_1", "", nil); !errors.Is(err, ErrEmptyEventName) {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	if !strings.Contains(out, "level=ERROR") || !strings.Contains(out, LogFieldClientId+"=client_1") {
+		t.Fatalf("fields are not passed as attributes: %q", out)
+	}
+	if strings.Contains(out, SDK_LOG_PREFIX) {
+		t.Fatalf("the message is prefixed: %q", out)
+	}
+}
+
+// nil means slog.Default()
+func TestSlogLoggerDefault(t *testing.T) {
+	defaultLogger := slog.Default()
+	t.Cleanup(func() { slog.SetDefault(defaultLogger) })
+	var buf bytes.Buffer
+	slog.SetDefault(slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelWarn})))
+
+	logger := NewSlogLogger(nil)
+	if logger.(GELevelEnabler).Enabled(GELogLevelInfo) || !logger.(GELevelEnabler).Enabled(GELogLevelError) {
+		t.Fatal("levels are not filtered by slog.Default()")
+	}
+	logger.Log(GELogLevelError, "failed", LogField{Key: LogFieldStatusCode, Value: 500})
+	if out := buf.String(); !strings.Contains(out, `msg=failed status_code=500`) {
+		t.Fatalf("unexpected output: %q", out)
+	}
+}
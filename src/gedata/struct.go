@@ -0,0 +1,178 @@
+package gedata
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+var (
+	timeType          = reflect.TypeOf(time.Time{})
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+)
+
+// structToProperties encode a struct into properties by `ge:"name,omitempty"` tags.
+// Fields without tag use the field name, `ge:"-"` skips the field, embedded structs are flattened.
+// time.Time and json.Marshaler are kept as they are, nested structs are encoded into maps.
+func structToProperties(v interface{}) (map[string]interface{}, error) {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr || rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			return nil, fmt.Errorf("%w: properties must not be nil", ErrInvalidProperty)
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("%w: properties must be struct, got %T", ErrInvalidProperty, v)
+	}
+
+	properties := make(map[string]interface{})
+	if err := encodeStructFields(rv, properties, true, 0); err != nil {
+		if !errors.Is(err, ErrInvalidProperty) {
+			err = fmt.Errorf("%w: %w", ErrInvalidProperty, err)
+		}
+		return nil, err
+	}
+	return properties, nil
+}
+
+func encodeStructFields(v reflect.Value, target map[string]interface{}, checkKey bool, depth int) error {
+	if depth > maxPropertyDepth {
+		return errTooDeep
+	}
+	t := v.Type()
+	// fields of the struct itself take precedence over the fields of embedded structs
+	fields := make(map[string]interface{})
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("ge")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		omitEmpty := false
+		for _, opt := range strings.Split(opts, ",") {
+			omitEmpty = omitEmpty || opt == "omitempty"
+		}
+		fv := v.Field(i)
+
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			ev := fv
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+				if !ev.IsNil() {
+					ev = ev.Elem()
+				}
+			}
+			if ft.Kind() == reflect.Struct && !isOpaqueType(ft) {
+				if ev.Kind() == reflect.Ptr {
+					// nil embedded pointer
+					continue
+				}
+				if err := encodeStructFields(ev, target, checkKey, depth+1); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		if omitEmpty && fv.IsZero() {
+			continue
+		}
+		if checkKey && !checkPattern([]byte(name)) {
+			return fmt.Errorf("%w: key %q of field %s must match %s", ErrInvalidProperty, name, f.Name, KEY_PATTERN)
+		}
+		encoded, err := encodeStructValue(fv, depth+1)
+		if err != nil {
+			return err
+		}
+		fields[name] = encoded
+	}
+	mergeProperties(target, fields)
+	return nil
+}
+
+func encodeStructValue(v reflect.Value, depth int) (interface{}, error) {
+	if !v.IsValid() {
+		return nil, nil
+	}
+	if depth > maxPropertyDepth {
+		return nil, errTooDeep
+	}
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return nil, nil
+		}
+		if v.Type().Implements(jsonMarshalerType) && v.CanInterface() {
+			return v.Interface(), nil
+		}
+		return encodeStructValue(v.Elem(), depth+1)
+	case reflect.Struct:
+		if isOpaqueType(v.Type()) {
+			return valueInterface(v), nil
+		}
+		if v.CanAddr() && v.Addr().CanInterface() && reflect.PointerTo(v.Type()).Implements(jsonMarshalerType) {
+			return v.Addr().Interface(), nil
+		}
+		m := make(map[string]interface{})
+		if err := encodeStructFields(v, m, false, depth+1); err != nil {
+			return nil, err
+		}
+		return m, nil
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return nil, nil
+		}
+		switch v.Type().Elem().Kind() {
+		case reflect.Struct, reflect.Ptr, reflect.Interface:
+			list := make([]interface{}, v.Len())
+			for i := range list {
+				nv, err := encodeStructValue(v.Index(i), depth+1)
+				if err != nil {
+					return nil, err
+				}
+				list[i] = nv
+			}
+			return list, nil
+		}
+		return valueInterface(v), nil
+	default:
+		return valueInterface(v), nil
+	}
+}
+
+// valueInterface return the value of v, values promoted from unexported embedded structs
+// can not be read by Interface, only their basic kinds are supported.
+func valueInterface(v reflect.Value) interface{} {
+	if v.CanInterface() {
+		return v.Interface()
+	}
+	switch v.Kind() {
+	case reflect.Bool:
+		return v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint()
+	case reflect.Float32, reflect.Float64:
+		return v.Float()
+	case reflect.String:
+		return v.String()
+	}
+	return nil
+}
+
+// isOpaqueType reports whether the struct type is encoded by itself instead of by its fields.
+func isOpaqueType(t reflect.Type) bool {
+	return t == timeType || t.Implements(jsonMarshalerType)
+}
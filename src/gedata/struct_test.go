@@ -0,0 +1,135 @@
+package gedata
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+)
+
+type structBase struct {
+	Channel string `ge:"channel"`
+	Level   int    `ge:"level"`
+}
+
+type structExtra struct {
+	Source string `ge:"source"`
+}
+
+type structAmount struct {
+	cents int64
+}
+
+func (a structAmount) MarshalJSON() ([]byte, error) {
+	return []byte(strconv.FormatInt(a.cents, 10)), nil
+}
+
+type structItem struct {
+	Id int `ge:"id"`
+}
+
+type structEvent struct {
+	structBase
+	*structExtra
+	Level    int    `ge:"level"` // takes precedence over the embedded field
+	Name     string `ge:"name"`
+	Note     string `ge:"note,omitempty"`
+	Empty    string `ge:"empty,omitempty"`
+	Secret   string `ge:"-"`
+	Untagged bool
+	At       time.Time    `ge:"at"`
+	Amount   structAmount `ge:"amount"`
+	Address  struct {
+		City string `ge:"city-name"` // keys of nested maps are not checked
+	} `ge:"address"`
+	Items  []structItem `ge:"items"`
+	hidden int
+}
+
+func TestStructToProperties(t *testing.T) {
+	at := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	v := structEvent{
+		structBase:  structBase{Channel: "store", Level: 1},
+		structExtra: &structExtra{Source: "ad"},
+		Level:       2,
+		Name:        "alice",
+		Note:        "note",
+		Secret:      "secret",
+		Untagged:    true,
+		At:          at,
+		Amount:      structAmount{cents: 600},
+		Items:       []structItem{{Id: 1}},
+		hidden:      1,
+	}
+	v.Address.City = "Beijing"
+
+	p, err := structToProperties(&v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]interface{}{
+		"channel":  "store",
+		"source":   "ad",
+		"level":    2,
+		"name":     "alice",
+		"note":     "note",
+		"Untagged": true,
+		"at":       at,
+		"amount":   structAmount{cents: 600},
+	}
+	for k, value := range expected {
+		if p[k] != value {
+			t.Errorf("%s = %#v, want %#v", k, p[k], value)
+		}
+	}
+	if address, ok := p["address"].(map[string]interface{}); !ok || address["city-name"] != "Beijing" {
+		t.Errorf("nested struct: %#v", p["address"])
+	}
+	if items, ok := p["items"].([]interface{}); !ok || len(items) != 1 || items[0].(map[string]interface{})["id"] != 1 {
+		t.Errorf("slice of structs: %#v", p["items"])
+	}
+	if len(p) != len(expected)+2 {
+		t.Errorf("unexpected properties: %v", p)
+	}
+
+	// nil embedded pointer is skipped
+	v.structExtra = nil
+	if p, err = structToProperties(v); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := p["source"]; ok {
+		t.Errorf("field of nil embedded pointer: %v", p["source"])
+	}
+}
+
+func TestStructToPropertiesErrors(t *testing.T) {
+	type badKey struct {
+		Bad int `ge:"1bad"`
+	}
+	for name, v := range map[string]interface{}{
+		"invalid key": badKey{},
+		"nil pointer": (*structEvent)(nil),
+		"not struct":  map[string]interface{}{"a": 1},
+		"nil":         nil,
+	} {
+		if _, err := structToProperties(v); !errors.Is(err, ErrInvalidProperty) {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+}
+
+func TestTrackStruct(t *testing.T) {
+	c := &recordConsumer{}
+	ge := New(c, WithLogLevel(GELogLevelOff))
+	at := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := ge.TrackStruct("client", "event", structEvent{Name: "alice", At: at, Amount: structAmount{cents: 600}}); err != nil {
+		t.Fatal(err)
+	}
+	p := c.items()[0].Properties
+	if p["name"] != "alice" || p["at"] != at.Format(DATE_FORMAT) {
+		t.Fatalf("properties: %v", p)
+	}
+	if err := ge.TrackStruct("client", "event", 1); !errors.Is(err, ErrInvalidProperty) {
+		t.Fatalf("TrackStruct of int: %v", err)
+	}
+}
@@ -0,0 +1,76 @@
+package gedata
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestEventTime(t *testing.T) {
+	now := time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+	eventTime := time.Date(2024, 1, 2, 3, 4, 5, 6000000, time.UTC)
+	local := time.Date(2024, 1, 2, 3, 4, 5, 6000000, time.Local)
+
+	for _, tc := range []struct {
+		name     string
+		call     func(ge GEAnalytics) error
+		expected time.Time
+		timeFree bool
+	}{
+		{"clock", func(ge GEAnalytics) error {
+			return ge.Track("client", "event", nil)
+		}, now, false},
+		{"argument", func(ge GEAnalytics) error {
+			return ge.TrackWithTime("client", "event", eventTime, nil)
+		}, eventTime, true},
+		{"argument takes precedence", func(ge GEAnalytics) error {
+			return ge.TrackWithTime("client", "event", eventTime, map[string]interface{}{"#time": now})
+		}, eventTime, true},
+		{"time.Time property", func(ge GEAnalytics) error {
+			return ge.Track("client", "event", map[string]interface{}{"#time": eventTime})
+		}, eventTime, true},
+		{"*time.Time property", func(ge GEAnalytics) error {
+			return ge.Track("client", "event", map[string]interface{}{"#time": &eventTime})
+		}, eventTime, true},
+		{"DATE_FORMAT property", func(ge GEAnalytics) error {
+			return ge.Track("client", "event", map[string]interface{}{"#time": "2024-01-02 03:04:05.006"})
+		}, local, true},
+		{"seconds property", func(ge GEAnalytics) error {
+			return ge.Track("client", "event", map[string]interface{}{"#time": "2024-01-02 03:04:05"})
+		}, local.Truncate(time.Second), true},
+		{"RFC3339 property", func(ge GEAnalytics) error {
+			return ge.Track("client", "event", map[string]interface{}{"#time": "2024-01-02T03:04:05.006Z"})
+		}, eventTime, true},
+		{"profile property", func(ge GEAnalytics) error {
+			return ge.UserSet("client", map[string]interface{}{"#time": eventTime, "level": 1})
+		}, eventTime, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c := &recordConsumer{}
+			ge := New(c, WithLogLevel(GELogLevelOff), WithClock(func() time.Time { return now }))
+			if err := tc.call(ge); err != nil {
+				t.Fatal(err)
+			}
+			item := c.items()[0]
+			if item.Time != tc.expected.UnixMilli() || item.TimeFree != tc.timeFree {
+				t.Fatalf("time %v, time_free %v, want %v, %v", time.UnixMilli(item.Time), item.TimeFree, tc.expected, tc.timeFree)
+			}
+			if _, ok := item.Properties["#time"]; ok {
+				t.Fatal("#time is sent as a property")
+			}
+		})
+	}
+}
+
+func TestInvalidEventTime(t *testing.T) {
+	c := &recordConsumer{}
+	ge := New(c, WithLogLevel(GELogLevelOff))
+	for _, value := range []interface{}{"yesterday", 1704164645, (*time.Time)(nil)} {
+		if err := ge.Track("client", "event", map[string]interface{}{"#time": value}); !errors.Is(err, ErrInvalidProperty) {
+			t.Errorf("#time %v: %v", value, err)
+		}
+	}
+	if len(c.data) != 0 {
+		t.Fatalf("events with invalid time are reported: %+v", c.data)
+	}
+}
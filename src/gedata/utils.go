@@ -22,20 +22,48 @@ func mergeProperties(target, source map[string]interface{}) {
 	}
 }
 
-func extractTime(p map[string]interface{}) string {
-	if t, ok := p["#time"]; ok {
-		delete(p, "#time")
-		switch v := t.(type) {
-		case string:
-			return v
-		case time.Time:
-			return v.Format(DATE_FORMAT)
-		default:
-			return time.Now().Format(DATE_FORMAT)
-		}
+// copyProperties is mergeProperties with nested maps and slices copied, so that target is owned by the SDK.
+func copyProperties(target, source map[string]interface{}) {
+	for k, v := range source {
+		target[k] = deepCopyValue(v)
+	}
+}
+
+// timeProperty is the reserved property of the event time, it is not reported as a property.
+const timeProperty = "#time"
+
+// extractTime remove the reserved "#time" property from p and return its value.
+func extractTime(p map[string]interface{}) (time.Time, bool, error) {
+	t, ok := p[timeProperty]
+	if !ok {
+		return time.Time{}, false, nil
 	}
+	delete(p, timeProperty)
+	v, err := parseTime(t)
+	return v, true, err
+}
 
-	return time.Now().Format(DATE_FORMAT)
+// parseTime accept time.Time, or string in DATE_FORMAT (local time) or RFC3339.
+func parseTime(t interface{}) (time.Time, error) {
+	switch v := t.(type) {
+	case time.Time:
+		return v, nil
+	case *time.Time:
+		if v != nil {
+			return *v, nil
+		}
+	case string:
+		for _, layout := range []string{DATE_FORMAT, "2006-01-02 15:04:05"} {
+			if r, err := time.ParseInLocation(layout, v, time.Local); err == nil {
+				return r, nil
+			}
+		}
+		if r, err := time.Parse(time.RFC3339Nano, v); err == nil {
+			return r, nil
+		}
+		return time.Time{}, fmt.Errorf("%w: invalid time format for #time: %q", ErrInvalidProperty, v)
+	}
+	return time.Time{}, fmt.Errorf("%w: invalid data type for #time: %T", ErrInvalidProperty, t)
 }
 
 func extractStringProperty(p map[string]interface{}, key string) string {
@@ -62,6 +90,9 @@ func isNotNumber(v interface{}) bool {
 
 func isNotArrayOrSlice(v interface{}) bool {
 	typeOf := reflect.TypeOf(v)
+	if typeOf == nil {
+		return true
+	}
 	switch typeOf.Kind() {
 	case reflect.Array:
 	case reflect.Slice:
@@ -74,3 +105,30 @@ func isNotArrayOrSlice(v interface{}) bool {
 func checkPattern(name []byte) bool {
 	return keyPattern.Match(name)
 }
+
+// checkProperties validate keys and values of properties according to the event type.
+func checkProperties(dataType, eventName string, properties map[string]interface{}) error {
+	if dataType == Profile && eventName == UserDel {
+		return nil
+	}
+	for _, k := range sortedKeys(properties) {
+		v := properties[k]
+		if !checkPattern([]byte(k)) {
+			return fmt.Errorf("%w: key %q in %s must match %s", ErrInvalidProperty, k, eventName, KEY_PATTERN)
+		}
+		if dataType != Profile {
+			continue
+		}
+		switch eventName {
+		case UserIncrement, UserNumMax, UserNumMin:
+			if isNotNumber(v) {
+				return fmt.Errorf("%w: value of %q in %s must be number, got %T", ErrInvalidProperty, k, eventName, v)
+			}
+		case UserAppend, UserUniqAppend:
+			if isNotArrayOrSlice(v) {
+				return fmt.Errorf("%w: value of %q in %s must be array or slice, got %T", ErrInvalidProperty, k, eventName, v)
+			}
+		}
+	}
+	return nil
+}
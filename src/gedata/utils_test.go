@@ -0,0 +1,77 @@
+package gedata
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestCheckProperties(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		call func(ge GEAnalytics) error
+	}{
+		{"key starting with digit", func(ge GEAnalytics) error {
+			return ge.Track("client", "event", map[string]interface{}{"1key": 1})
+		}},
+		{"key with dash", func(ge GEAnalytics) error {
+			return ge.UserSet("client", map[string]interface{}{"the-key": 1})
+		}},
+		{"long key", func(ge GEAnalytics) error {
+			return ge.Track("client", "event", map[string]interface{}{"k" + strings.Repeat("e", 50): 1})
+		}},
+		{"non-numeric Increment", func(ge GEAnalytics) error {
+			return ge.UserIncrement("client", map[string]interface{}{"coins": "5"})
+		}},
+		{"non-numeric Max", func(ge GEAnalytics) error {
+			return ge.UserNumMax("client", map[string]interface{}{"score": true})
+		}},
+		{"non-numeric Min", func(ge GEAnalytics) error {
+			return ge.UserNumMin("client", map[string]interface{}{"score": []int{1}})
+		}},
+		{"non-array Append", func(ge GEAnalytics) error {
+			return ge.UserAppend("client", map[string]interface{}{"tags": "a"})
+		}},
+		{"non-array UniqAppend", func(ge GEAnalytics) error {
+			return ge.UserUniqAppend("client", map[string]interface{}{"tags": 1})
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			stringent := &recordConsumer{stringent: true}
+			if err := tc.call(New(stringent, WithLogLevel(GELogLevelOff))); !errors.Is(err, ErrInvalidProperty) {
+				t.Fatalf("stringent consumer: %v", err)
+			}
+			if len(stringent.data) != 0 {
+				t.Fatal("stringent consumer receives invalid data")
+			}
+
+			lenient := &recordConsumer{}
+			logger := &bufferLogger{}
+			if err := tc.call(New(lenient, WithLogger(logger), WithLogLevel(GELogLevelWarning))); err != nil {
+				t.Fatalf("non-stringent consumer: %v", err)
+			}
+			if len(lenient.data) != 1 {
+				t.Fatal("non-stringent consumer does not receive the data")
+			}
+			if log := logger.String(); !strings.Contains(log, "[Warning]") || !strings.Contains(log, ErrInvalidProperty.Error()) {
+				t.Fatalf("no warning is logged: %q", log)
+			}
+		})
+	}
+}
+
+func TestCheckPropertiesAcceptsValidValues(t *testing.T) {
+	ge := New(&recordConsumer{stringent: true}, WithLogLevel(GELogLevelOff))
+	calls := map[string]error{
+		"Increment":  ge.UserIncrement("client", map[string]interface{}{"coins": 5, "$score": 1.5}),
+		"Max":        ge.UserNumMax("client", map[string]interface{}{"score": uint8(1)}),
+		"Append":     ge.UserAppend("client", map[string]interface{}{"tags": []string{"a"}}),
+		"UniqAppend": ge.UserUniqAppend("client", map[string]interface{}{"tags": [2]int{1, 2}}),
+		"Track":      ge.Track("client", "event", map[string]interface{}{"k" + strings.Repeat("e", 49): "50 chars"}),
+	}
+	for name, err := range calls {
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+}